@@ -0,0 +1,88 @@
+package up
+
+// Builder constructs a Document from Go code while preserving the order in
+// which top-level keys are added.
+//
+// Example:
+//
+//	doc := up.NewBuilder().
+//	    Set("name", "api").
+//	    SetTyped("port", "int", "8080").
+//	    Block("database", func(b *up.BlockBuilder) {
+//	        b.Set("host", "localhost").List("replicas", "db1", "db2")
+//	    }).
+//	    Document()
+type Builder struct {
+	doc *Document
+}
+
+// NewBuilder creates a new Builder with an empty document.
+func NewBuilder() *Builder {
+	return &Builder{doc: &Document{Nodes: []Node{}}}
+}
+
+// Set adds or replaces a top-level key.
+func (b *Builder) Set(key string, value Value) *Builder {
+	return b.SetTyped(key, "", value)
+}
+
+// SetTyped adds or replaces a top-level key with a type annotation.
+func (b *Builder) SetTyped(key, typ string, value Value) *Builder {
+	node := Node{Key: key, Type: typ, Value: value}
+	if idx := b.doc.nodeIndex(key); idx != -1 {
+		b.doc.Nodes[idx] = node
+	} else {
+		b.doc.Nodes = append(b.doc.Nodes, node)
+	}
+	return b
+}
+
+// Block adds a top-level block populated by fn.
+func (b *Builder) Block(key string, fn func(*BlockBuilder)) *Builder {
+	bb := NewBlockBuilder()
+	fn(bb)
+	return b.Set(key, bb.Build())
+}
+
+// List adds a top-level list.
+func (b *Builder) List(key string, items ...Value) *Builder {
+	return b.Set(key, List(items))
+}
+
+// Document returns the built document.
+func (b *Builder) Document() *Document {
+	return b.doc
+}
+
+// BlockBuilder constructs a Block.
+type BlockBuilder struct {
+	block Block
+}
+
+// NewBlockBuilder creates a new BlockBuilder with an empty block.
+func NewBlockBuilder() *BlockBuilder {
+	return &BlockBuilder{block: make(Block)}
+}
+
+// Set adds or replaces a key in the block.
+func (b *BlockBuilder) Set(key string, value Value) *BlockBuilder {
+	b.block[key] = value
+	return b
+}
+
+// Block adds a nested block populated by fn.
+func (b *BlockBuilder) Block(key string, fn func(*BlockBuilder)) *BlockBuilder {
+	nested := NewBlockBuilder()
+	fn(nested)
+	return b.Set(key, nested.Build())
+}
+
+// List adds a list to the block.
+func (b *BlockBuilder) List(key string, items ...Value) *BlockBuilder {
+	return b.Set(key, List(items))
+}
+
+// Build returns the built block.
+func (b *BlockBuilder) Build() Block {
+	return b.block
+}
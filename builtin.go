@@ -0,0 +1,172 @@
+package up
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ByteSize is a size in bytes that decodes from values such as "512",
+// "10MB" or "1.5GiB". Decimal units (kB, KB, MB, GB, TB, PB) are powers of
+// 1000; binary units (KiB, MiB, GiB, TiB, PiB) and the single letters K,
+// M, G, T and P are powers of 1024. Lower-case decimal units (kb, mb, gb,
+// tb, pb) are accepted as well.
+type ByteSize int64
+
+// Common byte sizes.
+const (
+	Byte     ByteSize = 1
+	Kilobyte ByteSize = 1000
+	Megabyte          = 1000 * Kilobyte
+	Gigabyte          = 1000 * Megabyte
+	Terabyte          = 1000 * Gigabyte
+	Petabyte          = 1000 * Terabyte
+	Kibibyte ByteSize = 1024
+	Mebibyte          = 1024 * Kibibyte
+	Gibibyte          = 1024 * Mebibyte
+	Tebibyte          = 1024 * Gibibyte
+	Pebibyte          = 1024 * Tebibyte
+)
+
+// byteSizeUnits maps unit suffixes to their size.
+var byteSizeUnits = map[string]ByteSize{
+	"": Byte, "B": Byte,
+	"kB": Kilobyte, "KB": Kilobyte, "kb": Kilobyte,
+	"MB": Megabyte, "mb": Megabyte,
+	"GB": Gigabyte, "gb": Gigabyte,
+	"TB": Terabyte, "tb": Terabyte,
+	"PB": Petabyte, "pb": Petabyte,
+	"K": Kibibyte, "KiB": Kibibyte,
+	"M": Mebibyte, "MiB": Mebibyte,
+	"G": Gibibyte, "GiB": Gibibyte,
+	"T": Tebibyte, "TiB": Tebibyte,
+	"P": Pebibyte, "PiB": Pebibyte,
+}
+
+// ParseByteSize parses a size such as "10MiB" or "1.5GB".
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if end == -1 {
+		end = len(s)
+	}
+	number, unit := s[:end], strings.TrimSpace(s[end:])
+
+	scale, ok := byteSizeUnits[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size %q", s)
+	}
+	size := math.Round(n * float64(scale))
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("byte size %q is too large", s)
+	}
+	return ByteSize(size), nil
+}
+
+// String formats the size with the largest binary unit that divides it
+// exactly, such as "10MiB", or as a plain number of bytes.
+func (b ByteSize) String() string {
+	for _, u := range []struct {
+		suffix string
+		size   ByteSize
+	}{
+		{"PiB", Pebibyte}, {"TiB", Tebibyte}, {"GiB", Gibibyte}, {"MiB", Mebibyte}, {"KiB", Kibibyte},
+	} {
+		if b != 0 && b%u.size == 0 {
+			return strconv.FormatInt(int64(b/u.size), 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+	urlType      = reflect.TypeOf(url.URL{})
+)
+
+// timeLayouts are the layouts accepted for time.Time values, in order.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// unmarshalBuiltin decodes standard library types that have no suitable
+// text encoding of their own (time.Duration, url.URL) or that accept more
+// formats than their own (time.Time). It reports whether the field has one
+// of these types.
+func unmarshalBuiltin(field reflect.Value, value any) (bool, error) {
+	t := field.Type()
+	if t != durationType && t != timeType && t != urlType {
+		return false, nil
+	}
+	s, ok := value.(string)
+	if !ok {
+		return true, fmt.Errorf("cannot unmarshal %s into %s", describeValue(value), t)
+	}
+
+	switch t {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return true, fmt.Errorf("invalid duration %q", s)
+		}
+		field.SetInt(int64(d))
+	case timeType:
+		for _, layout := range timeLayouts {
+			if tm, err := time.Parse(layout, s); err == nil {
+				field.Set(reflect.ValueOf(tm))
+				return true, nil
+			}
+		}
+		return true, fmt.Errorf("invalid time %q, expected RFC 3339 or YYYY-MM-DD", s)
+	case urlType:
+		u, err := url.Parse(s)
+		if err != nil {
+			return true, fmt.Errorf("invalid URL %q", s)
+		}
+		field.Set(reflect.ValueOf(*u))
+	}
+	return true, nil
+}
+
+// marshalBuiltin encodes the types handled by unmarshalBuiltin that have
+// no text encoding of their own. It reports whether rv has one of them.
+func marshalBuiltin(rv reflect.Value) (bool, Value) {
+	switch rv.Type() {
+	case durationType:
+		return true, time.Duration(rv.Int()).String()
+	case urlType:
+		u := rv.Interface().(url.URL)
+		return true, u.String()
+	}
+	return false, nil
+}
@@ -0,0 +1,110 @@
+// Command up-gen generates Go struct definitions for UP documents, either
+// from a UP schema or from sample documents whose types are inferred from
+// annotations such as !int and !bool. The generated types carry up tags
+// and can be passed to up.Unmarshal.
+//
+// It is intended for use with go generate:
+//
+//	//go:generate go run github.com/uplang/go/cmd/up-gen -schema config.schema.up -type Config -o config_gen.go
+//
+// Usage:
+//
+//	up-gen [-schema file] [-type name] [-package name] [-o output] [sample.up ...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	up "github.com/uplang/go"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command and returns the process exit code.
+func run(args []string) int {
+	fs := flag.NewFlagSet("up-gen", flag.ContinueOnError)
+	schemaPath := fs.String("schema", "", "read the schema from this file instead of inferring it from samples")
+	typeName := fs.String("type", "Config", "name of the root struct")
+	pkg := fs.String("package", os.Getenv("GOPACKAGE"), "package of the generated file (defaults to $GOPACKAGE)")
+	output := fs.String("o", "", "write the generated code here instead of standard output")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: up-gen [-schema file] [-type name] [-package name] [-o output] [sample.up ...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if (*schemaPath == "") == (fs.NArg() == 0) {
+		fmt.Fprintln(os.Stderr, "up-gen: need either -schema or sample documents, but not both")
+		fs.Usage()
+		return 2
+	}
+	if *pkg == "" {
+		*pkg = "main"
+	}
+
+	schema, err := loadSchema(*schemaPath, fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "up-gen: %v\n", err)
+		return 1
+	}
+
+	src, err := up.GenerateGo(schema, up.GoOptions{Package: *pkg, TypeName: *typeName})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "up-gen: %v\n", err)
+		return 1
+	}
+
+	if *output == "" {
+		if _, err := os.Stdout.Write(src); err != nil {
+			fmt.Fprintf(os.Stderr, "up-gen: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "up-gen: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// loadSchema reads the schema file, or infers a schema from the samples.
+func loadSchema(schemaPath string, samples []string) (*up.Schema, error) {
+	if schemaPath != "" {
+		f, err := os.Open(schemaPath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		schema, err := up.ParseSchema(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", schemaPath, err)
+		}
+		return schema, nil
+	}
+
+	docs := make([]*up.Document, len(samples))
+	for i, path := range samples {
+		doc, err := parseFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		docs[i] = doc
+	}
+	return up.InferSchema(docs...), nil
+}
+
+// parseFile parses a UP document from disk.
+func parseFile(path string) (*up.Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return up.NewParser().ParseDocument(f)
+}
@@ -0,0 +1,156 @@
+// Command up-merge performs a structural three-way merge of UP documents.
+// It follows the git merge driver protocol: the merged result is written
+// over the "ours" file and the exit status is 1 when conflicts remain.
+// Conflicts are written between git-style <<<<<<< ours, ======= and
+// >>>>>>> theirs markers: the lines that differ are shown once with our
+// side of every conflict and once with theirs.
+//
+// Configure it in .git/config (or ~/.gitconfig):
+//
+//	[merge "up"]
+//	    name = UP structural merge
+//	    driver = up-merge -path %P %O %A %B
+//
+// and in .gitattributes:
+//
+//	*.up merge=up
+//
+// Usage:
+//
+//	up-merge [-path name] [-o output] base ours theirs
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+
+	up "github.com/uplang/go"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command and returns the process exit code:
+// 0 for a clean merge, 1 for conflicts and 2 for errors.
+func run(args []string) int {
+	fs := flag.NewFlagSet("up-merge", flag.ContinueOnError)
+	name := fs.String("path", "", "path of the merged file, used in messages")
+	output := fs.String("o", "", "write the result here instead of over the ours file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: up-merge [-path name] [-o output] base ours theirs")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return 2
+	}
+
+	basePath, oursPath, theirsPath := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+	if *name == "" {
+		*name = oursPath
+	}
+	if *output == "" {
+		*output = oursPath
+	}
+
+	docs := make([]*up.Document, 3)
+	for i, path := range []string{basePath, oursPath, theirsPath} {
+		doc, err := parseFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "up-merge: %s: %v\n", path, err)
+			return 2
+		}
+		docs[i] = doc
+	}
+
+	result := up.Merge3(docs[0], docs[1], docs[2])
+
+	data, err := up.Format(result.Document)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "up-merge: %s: %v\n", *name, err)
+		return 2
+	}
+	if result.HasConflicts() {
+		theirs, err := up.Format(theirSide(result))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "up-merge: %s: %v\n", *name, err)
+			return 2
+		}
+		data = conflictMarkers(data, theirs)
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		fmt.Fprintf(os.Stderr, "up-merge: %v\n", err)
+		return 2
+	}
+
+	if result.HasConflicts() {
+		for _, c := range result.Conflicts {
+			fmt.Fprintf(os.Stderr, "CONFLICT (up): %s: %s\n", *name, c)
+		}
+		return 1
+	}
+	return 0
+}
+
+// theirSide returns the merged document with their side of every conflict
+// in place of ours.
+func theirSide(result *up.MergeResult) *up.Document {
+	doc := result.Document.Clone()
+	for _, c := range result.Conflicts {
+		path := c.Path.String()
+		switch {
+		case c.Type:
+			typ, _ := c.Theirs.(string)
+			_ = doc.SetAnnotation(path, typ)
+		case c.Theirs == nil:
+			_ = doc.Delete(path)
+		default:
+			_ = doc.Set(path, c.Theirs)
+		}
+	}
+	return doc
+}
+
+// conflictMarkers wraps the lines that differ between our and their
+// rendering of the merge in conflict markers; the lines they share at the
+// start and end are written once.
+func conflictMarkers(ours, theirs []byte) []byte {
+	a := bytes.SplitAfter(ours, []byte("\n"))
+	b := bytes.SplitAfter(theirs, []byte("\n"))
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && bytes.Equal(a[prefix], b[prefix]) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		bytes.Equal(a[len(a)-1-suffix], b[len(b)-1-suffix]) {
+		suffix++
+	}
+
+	var buf bytes.Buffer
+	buf.Write(bytes.Join(a[:prefix], nil))
+	buf.WriteString("<<<<<<< ours\n")
+	buf.Write(bytes.Join(a[prefix:len(a)-suffix], nil))
+	buf.WriteString("=======\n")
+	buf.Write(bytes.Join(b[prefix:len(b)-suffix], nil))
+	buf.WriteString(">>>>>>> theirs\n")
+	buf.Write(bytes.Join(a[len(a)-suffix:], nil))
+	return buf.Bytes()
+}
+
+// parseFile parses a UP document from disk.
+func parseFile(path string) (*up.Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return up.NewParser().ParseDocument(f)
+}
@@ -0,0 +1,211 @@
+package up
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Source identifies where the value of a struct field came from.
+type Source int
+
+const (
+	SourceNone    Source = iota // the field was not set
+	SourceDefault               // the default= option of its up tag
+	SourceFile                  // the document
+	SourceEnv                   // the environment variable named by its env tag
+)
+
+func (s Source) String() string {
+	switch s {
+	case SourceDefault:
+		return "default"
+	case SourceFile:
+		return "file"
+	case SourceEnv:
+		return "env"
+	default:
+		return "none"
+	}
+}
+
+// tagDefault returns the value of the default= option of an up tag. The
+// default extends to the end of the tag, so it may contain commas:
+// `up:"hosts,default=[a, b]"`.
+func tagDefault(tag string) (string, bool) {
+	if strings.HasPrefix(tag, "default=") {
+		return tag[len("default="):], true
+	}
+	i := strings.Index(tag, ",default=")
+	if i == -1 {
+		return "", false
+	}
+	return tag[i+len(",default="):], true
+}
+
+// tagValue converts the text of a default or an environment variable into
+// a value for a field of type t. Scalars are used as is; lists, blocks and
+// tables are parsed with the UP value syntax, such as "[a, b]".
+func tagValue(t reflect.Type, text string) (any, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if customKind(t) != "" {
+		return text, nil
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+	default:
+		return text, nil
+	}
+
+	doc, err := NewParser().ParseDocument(strings.NewReader("value " + text + "\n"))
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Nodes) != 1 {
+		return nil, fmt.Errorf("invalid value %q", text)
+	}
+	return doc.Nodes[0].Value, nil
+}
+
+// setTagValue sets a field located at path from the text of a default or
+// an environment variable and records its source. Errors name the origin
+// of the text, such as "env APP_PORT".
+func (d *decodeState) setTagValue(field reflect.Value, text string, path Path, source Source, origin string) error {
+	d.origin = origin
+	defer func() { d.origin = "" }()
+
+	value, err := tagValue(field.Type(), text)
+	if err != nil {
+		return d.fail(path, field.Type(), text, err)
+	}
+	if err := d.setField(field, value, path); err != nil {
+		return err
+	}
+	d.setSource(path, source)
+	return nil
+}
+
+// applyEnv overrides a field located at path with the environment variable
+// named by its env tag, if the variable is set.
+func (d *decodeState) applyEnv(field reflect.StructField, fieldValue reflect.Value, path Path) error {
+	text, ok := lookupEnv(field)
+	if !ok {
+		return nil
+	}
+	return d.setTagValue(fieldValue, text, path, SourceEnv, "env "+field.Tag.Get("env"))
+}
+
+// lookupEnv returns the environment variable named by the env tag of a
+// field and whether it is set.
+func lookupEnv(field reflect.StructField) (string, bool) {
+	name := field.Tag.Get("env")
+	if name == "" {
+		return "", false
+	}
+	return os.LookupEnv(name)
+}
+
+// applyDefaults sets the defaults and environment overrides of the fields
+// of a struct located at path whose block is missing from the document.
+// Nested structs are visited as well; see applyNestedDefaults.
+func (d *decodeState) applyDefaults(v reflect.Value, path Path) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldValue := v.Field(i)
+		tag := field.Tag.Get("up")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+
+		if isInline(field, name, opts) {
+			if field.Type.Kind() == reflect.Struct {
+				if err := d.applyDefaults(fieldValue, path); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !fieldValue.CanSet() || hasOption(opts, "remain") {
+			continue
+		}
+		if name == "" {
+			name = d.naming.key(field.Name)
+		}
+		p := path.Key(name)
+
+		d.pushField(field.Name)
+		err := d.applyDefault(field, fieldValue, tag, p)
+		d.popField()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyDefault sets the default and environment override of a field
+// located at path.
+func (d *decodeState) applyDefault(field reflect.StructField, fieldValue reflect.Value, tag string, path Path) error {
+	if text, ok := tagDefault(tag); ok {
+		if err := d.setTagValue(fieldValue, text, path, SourceDefault, "default"); err != nil {
+			return err
+		}
+	} else if err := d.applyNestedDefaults(fieldValue, path); err != nil {
+		return err
+	}
+	return d.applyEnv(field, fieldValue, path)
+}
+
+// applyNestedDefaults applies the defaults below a struct or pointer to
+// struct field located at path whose block is missing from the document.
+// A nil pointer is only allocated if a default or environment variable
+// applies to one of its fields; recursive types are not expanded.
+func (d *decodeState) applyNestedDefaults(fieldValue reflect.Value, path Path) error {
+	t := fieldValue.Type()
+	if isPlainStruct(t) {
+		return d.applyDefaults(fieldValue, path)
+	}
+	if t.Kind() != reflect.Ptr || !isPlainStruct(t.Elem()) {
+		return nil
+	}
+	if !fieldValue.IsNil() {
+		return d.applyDefaults(fieldValue.Elem(), path)
+	}
+	if d.defaulting[t.Elem()] {
+		return nil
+	}
+
+	if d.defaulting == nil {
+		d.defaulting = make(map[reflect.Type]bool)
+	}
+	d.defaulting[t.Elem()] = true
+	defer delete(d.defaulting, t.Elem())
+
+	elem := reflect.New(t.Elem())
+	before := len(d.sources)
+	if err := d.applyDefaults(elem.Elem(), path); err != nil {
+		return err
+	}
+	if len(d.sources) > before {
+		fieldValue.Set(elem)
+	}
+	return nil
+}
+
+// isPlainStruct reports whether t is a struct decoded field by field.
+func isPlainStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && customKind(t) == ""
+}
+
+// setSource records the source of the value at path.
+func (d *decodeState) setSource(path Path, source Source) {
+	if d.sources == nil {
+		d.sources = make(map[string]Source)
+	}
+	d.sources[path.String()] = source
+}
@@ -0,0 +1,266 @@
+package up
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ChangeKind identifies the kind of a Change.
+type ChangeKind string
+
+// Change kinds reported by Diff.
+const (
+	Added       ChangeKind = "added"
+	Removed     ChangeKind = "removed"
+	Modified    ChangeKind = "changed"
+	TypeChanged ChangeKind = "type-changed"
+)
+
+// Change describes a single difference between two documents.
+type Change struct {
+	Kind     ChangeKind `json:"kind"`
+	Path     Path       `json:"path"`
+	OldValue Value      `json:"old,omitempty"`
+	NewValue Value      `json:"new,omitempty"`
+	OldType  string     `json:"old_type,omitempty"` // Set for TypeChanged
+	NewType  string     `json:"new_type,omitempty"` // Set for TypeChanged
+}
+
+// Changes is the result of Diff.
+type Changes []Change
+
+// Diff compares two documents structurally and reports added, removed and
+// changed paths, including changed type annotations. Blocks are compared
+// key by key and lists element by element; inline and multi-line lists
+// with the same items are equal. Directives are compared by name and
+// reported with paths such as "!use".
+func Diff(a, b *Document) Changes {
+	changes := diffDirectives(a, b)
+
+	seen := make(map[string]bool)
+	for _, node := range a.Nodes {
+		if seen[node.Key] {
+			continue
+		}
+		seen[node.Key] = true
+		path := Path{{Key: node.Key}}
+
+		idx := b.nodeIndex(node.Key)
+		if idx == -1 {
+			changes = append(changes, Change{Kind: Removed, Path: path, OldValue: node.Value})
+			continue
+		}
+		changes = diffValues(changes, a, b, path, node.Value, b.Nodes[idx].Value)
+	}
+
+	for _, node := range b.Nodes {
+		if seen[node.Key] {
+			continue
+		}
+		seen[node.Key] = true
+		changes = append(changes, Change{Kind: Added, Path: Path{{Key: node.Key}}, NewValue: node.Value})
+	}
+
+	return changes
+}
+
+// diffDirectives reports changes to document directives.
+func diffDirectives(a, b *Document) Changes {
+	var changes Changes
+	for _, dir := range a.Directives {
+		path := Path{{Key: "!" + dir.Name}}
+		other, ok := b.Directive(dir.Name)
+		switch {
+		case !ok:
+			changes = append(changes, Change{Kind: Removed, Path: path, OldValue: dir.Value})
+		case !Equal(dir.Value, other.Value):
+			changes = append(changes, Change{Kind: Modified, Path: path, OldValue: dir.Value, NewValue: other.Value})
+		}
+	}
+	for _, dir := range b.Directives {
+		if _, ok := a.Directive(dir.Name); !ok {
+			changes = append(changes, Change{Kind: Added, Path: Path{{Key: "!" + dir.Name}}, NewValue: dir.Value})
+		}
+	}
+	return changes
+}
+
+// diffValues appends the differences between two values located at path.
+func diffValues(changes Changes, a, b *Document, path Path, va, vb Value) Changes {
+	if ta, tb := a.annotation(path), b.annotation(path); ta != tb {
+		changes = append(changes, Change{Kind: TypeChanged, Path: path, OldType: ta, NewType: tb})
+	}
+
+	ma, aIsMap := asMap(va)
+	mb, bIsMap := asMap(vb)
+	if aIsMap && bIsMap {
+		keys := make([]string, 0, len(ma)+len(mb))
+		for k := range ma {
+			keys = append(keys, k)
+		}
+		for k := range mb {
+			if _, ok := ma[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			p := path.Key(k)
+			av, inA := ma[k]
+			bv, inB := mb[k]
+			switch {
+			case !inB:
+				changes = append(changes, Change{Kind: Removed, Path: p, OldValue: av})
+			case !inA:
+				changes = append(changes, Change{Kind: Added, Path: p, NewValue: bv})
+			default:
+				changes = diffValues(changes, a, b, p, av, bv)
+			}
+		}
+		return changes
+	}
+
+	la, aIsList := asList(va)
+	lb, bIsList := asList(vb)
+	if aIsList && bIsList {
+		for i := 0; i < max(len(la), len(lb)); i++ {
+			p := path.Index(i)
+			switch {
+			case i >= len(lb):
+				changes = append(changes, Change{Kind: Removed, Path: p, OldValue: la[i]})
+			case i >= len(la):
+				changes = append(changes, Change{Kind: Added, Path: p, NewValue: lb[i]})
+			default:
+				changes = diffValues(changes, a, b, p, la[i], lb[i])
+			}
+		}
+		return changes
+	}
+
+	if !Equal(va, vb) {
+		changes = append(changes, Change{Kind: Modified, Path: path, OldValue: va, NewValue: vb})
+	}
+	return changes
+}
+
+// Equal reports whether two UP values are deeply equal. Blocks compare
+// equal to tables' raw maps and inline lists to multi-line lists when
+// their contents match.
+func Equal(a, b Value) bool {
+	if ma, ok := asMap(a); ok {
+		mb, ok := asMap(b)
+		if !ok || len(ma) != len(mb) {
+			return false
+		}
+		for k, v := range ma {
+			other, ok := mb[k]
+			if !ok || !Equal(v, other) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if la, ok := asList(a); ok {
+		lb, ok := asList(b)
+		if !ok || len(la) != len(lb) {
+			return false
+		}
+		for i := range la {
+			if !Equal(la[i], lb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+// asMap returns the entries of a Block or raw map for reading. Raw maps
+// are copied, so the result must not be modified.
+func asMap(v Value) (Block, bool) {
+	switch m := v.(type) {
+	case Block:
+		return m, true
+	case map[string]any:
+		block := make(Block, len(m))
+		for k, val := range m {
+			block[k] = val
+		}
+		return block, true
+	}
+	return nil, false
+}
+
+// asList returns the items of a List or inline list for reading. Inline
+// lists are copied, so the result must not be modified.
+func asList(v Value) (List, bool) {
+	switch l := v.(type) {
+	case List:
+		return l, true
+	case []any:
+		list := make(List, len(l))
+		for i, item := range l {
+			list[i] = item
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// String renders the changes as text, one per line, prefixed with '+' for
+// added paths, '-' for removed paths, '~' for changed values and '!' for
+// changed type annotations.
+func (c Changes) String() string {
+	var sb strings.Builder
+	for _, change := range c {
+		switch change.Kind {
+		case Added:
+			fmt.Fprintf(&sb, "+ %s: %s\n", change.Path, formatDiffValue(change.NewValue))
+		case Removed:
+			fmt.Fprintf(&sb, "- %s: %s\n", change.Path, formatDiffValue(change.OldValue))
+		case Modified:
+			fmt.Fprintf(&sb, "~ %s: %s -> %s\n", change.Path,
+				formatDiffValue(change.OldValue), formatDiffValue(change.NewValue))
+		case TypeChanged:
+			fmt.Fprintf(&sb, "! %s: %s -> %s\n", change.Path,
+				formatDiffType(change.OldType), formatDiffType(change.NewType))
+		}
+	}
+	return sb.String()
+}
+
+// JSON renders the changes as a JSON array.
+func (c Changes) JSON() ([]byte, error) {
+	if c == nil {
+		c = Changes{}
+	}
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// formatDiffValue renders a value on a single line for text diffs.
+func formatDiffValue(v Value) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+// formatDiffType renders a type annotation for text diffs.
+func formatDiffType(typ string) string {
+	if typ == "" {
+		return "(none)"
+	}
+	return "!" + typ
+}
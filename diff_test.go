@@ -0,0 +1,95 @@
+package up
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	before := `name demo
+port!int 8080
+server {
+host localhost
+debug false
+}
+tags [a, b, c]
+legacy yes
+`
+	after := `name demo
+port!string 8080
+server {
+host 0.0.0.0
+timeout 30s
+}
+tags [
+a
+x
+]
+extra 1
+`
+
+	p := NewParser()
+	a, err := p.ParseDocument(strings.NewReader(before))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+	b, err := p.ParseDocument(strings.NewReader(after))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	expected := `! port: !int -> !string
+- server.debug: "false"
+~ server.host: "localhost" -> "0.0.0.0"
++ server.timeout: "30s"
+~ tags[1]: "b" -> "x"
+- tags[2]: "c"
+- legacy: "yes"
++ extra: "1"
+`
+	changes := Diff(a, b)
+	if changes.String() != expected {
+		t.Errorf("Diff():\nexpected:\n%s\ngot:\n%s", expected, changes.String())
+	}
+
+	data, err := changes.JSON()
+	if err != nil {
+		t.Fatalf("JSON() failed: %v", err)
+	}
+	var decoded []struct {
+		Kind ChangeKind `json:"kind"`
+		Path Path       `json:"path"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if len(decoded) != len(changes) || decoded[4].Path.String() != "tags[1]" || decoded[4].Kind != Modified {
+		t.Errorf("unexpected JSON rendering: %s", data)
+	}
+
+	if len(Diff(a, a.Clone())) != 0 {
+		t.Error("expected no changes between a document and its clone")
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b     Value
+		expected bool
+	}{
+		{"x", "x", true},
+		{"x", "y", false},
+		{List{"a", "b"}, []any{"a", "b"}, true},
+		{List{"a"}, List{"a", "b"}, false},
+		{Block{"k": List{"v"}}, Block{"k": []any{"v"}}, true},
+		{Block{"k": "v"}, Block{"k": "w"}, false},
+		{Block{"k": "v"}, "v", false},
+	}
+
+	for _, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Equal(%v, %v) = %v, expected %v", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
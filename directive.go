@@ -0,0 +1,50 @@
+package up
+
+import (
+	"fmt"
+)
+
+// Uses returns the namespaces declared by all !use directives, in order.
+func (d *Document) Uses() []string {
+	var namespaces []string
+	for _, dir := range d.Directives {
+		if use, ok := dir.Value.(UseDirective); ok && dir.Name == "use" {
+			namespaces = append(namespaces, use.Namespaces...)
+		}
+	}
+	return namespaces
+}
+
+// LintRules returns the rules declared by all !lint directives. Rules from
+// a single block are sorted by name; a later rule with the same name
+// overrides an earlier one.
+func (d *Document) LintRules() []LintRule {
+	var rules []LintRule
+	index := make(map[string]int)
+	for _, dir := range d.Directives {
+		block, ok := dir.Value.(Block)
+		if !ok || dir.Name != "lint" {
+			continue
+		}
+		for _, c := range mapChildren(block) {
+			rule := LintRule{Name: c.elem.Key, Level: fmt.Sprint(c.value)}
+			if i, ok := index[rule.Name]; ok {
+				rules[i] = rule
+				continue
+			}
+			index[rule.Name] = len(rules)
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// Directive returns the first directive with the given name.
+func (d *Document) Directive(name string) (Directive, bool) {
+	for _, dir := range d.Directives {
+		if dir.Name == name {
+			return dir, true
+		}
+	}
+	return Directive{}, false
+}
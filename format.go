@@ -0,0 +1,298 @@
+package up
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// indentUnit is the indentation used for nested blocks and lists.
+const indentUnit = "  "
+
+// Format renders a document as UP text. Blocks are written with their
+// keys in sorted order and values that the parser would otherwise
+// reinterpret (leading brackets, surrounding quotes or whitespace, newlines)
+// are written as multiline strings or quoted.
+func Format(doc *Document) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := doc.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteTo writes the document as UP text to w. It implements io.WriterTo.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	f := &formatter{doc: d}
+	if err := f.writeDocument(); err != nil {
+		return 0, err
+	}
+	n, err := w.Write(f.buf.Bytes())
+	return int64(n), err
+}
+
+// formatter accumulates formatted output for a document.
+type formatter struct {
+	doc  *Document
+	buf  bytes.Buffer
+	unit string // indentation per depth; indentUnit if empty
+}
+
+// indent returns the indentation for the given depth.
+func (f *formatter) indent(depth int) string {
+	if f.unit == "" {
+		return strings.Repeat(indentUnit, depth)
+	}
+	return strings.Repeat(f.unit, depth)
+}
+
+// writeDocument writes the directives and nodes of the document.
+func (f *formatter) writeDocument() error {
+	for _, dir := range f.doc.Directives {
+		if err := f.writeDirective(dir); err != nil {
+			return err
+		}
+	}
+	for _, node := range f.doc.Nodes {
+		if err := f.writeNode(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeNode writes a top-level node.
+func (f *formatter) writeNode(node Node) error {
+	return f.writeEntry(Path{{Key: node.Key}}, node.Key, node.Type, node.Value, 0)
+}
+
+// writeDirective writes a document-level directive.
+func (f *formatter) writeDirective(dir Directive) error {
+	switch v := dir.Value.(type) {
+	case UseDirective:
+		f.buf.WriteString("!" + dir.Name + " [" + strings.Join(v.Namespaces, ", ") + "]\n")
+		return nil
+	case Block:
+		f.buf.WriteString("!" + dir.Name + " {\n")
+		if err := f.writeBlockBody(nil, v, 1); err != nil {
+			return err
+		}
+		f.buf.WriteString("}\n")
+		return nil
+	default:
+		return fmt.Errorf("cannot format directive !%s of type %T", dir.Name, dir.Value)
+	}
+}
+
+// writeEntry writes "key!type value" at the given depth.
+func (f *formatter) writeEntry(path Path, key, typ string, value Value, depth int) error {
+	indent := f.indent(depth)
+	// Keys must survive splitKeyValue and parseKeyAndType unchanged
+	if key == "" || strings.ContainsAny(key, " \t!{") || strings.HasSuffix(key, ":") {
+		return fmt.Errorf("cannot format key %q at %s", key, path)
+	}
+	if t, ok := value.(Table); ok {
+		value = map[string]any{"columns": t.Columns, "rows": t.Rows}
+		if typ == "" {
+			typ = "table"
+		}
+	}
+	head := indent + key
+	if typ != "" {
+		head += "!" + typ
+	}
+	if typ == "table" {
+		if table, ok := asMap(value); ok {
+			return f.writeTable(path, head, table, depth)
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		f.buf.WriteString(head + "\n")
+	case string:
+		f.writeScalar(head, typ, v, indent)
+	case Block:
+		f.buf.WriteString(head + " {\n")
+		if err := f.writeBlockBody(path, v, depth+1); err != nil {
+			return err
+		}
+		f.buf.WriteString(indent + "}\n")
+	case map[string]any:
+		block, _ := asMap(v)
+		return f.writeEntry(path, key, typ, block, depth)
+	case List:
+		return f.writeList(path, head, v, depth)
+	case []any:
+		list, _ := asList(v)
+		if inline, ok := formatInlineList(list); ok {
+			f.buf.WriteString(head + " " + inline + "\n")
+			return nil
+		}
+		return f.writeList(path, head, list, depth)
+	default:
+		return fmt.Errorf("cannot format %T at %s", value, path)
+	}
+	return nil
+}
+
+// writeTable writes a table in the form parseTable reads back:
+//
+//	key!table {
+//	  columns [a, b]
+//	  rows {
+//	    [1, 2]
+//	  }
+//	}
+func (f *formatter) writeTable(path Path, head string, table Block, depth int) error {
+	indent := f.indent(depth)
+	inner := f.indent(depth + 1)
+
+	for key := range table {
+		if key != "columns" && key != "rows" {
+			return fmt.Errorf("cannot format table key %q at %s", key, path)
+		}
+	}
+
+	f.buf.WriteString(head + " {\n")
+	if columns, ok := table["columns"]; ok {
+		list, isList := asList(columns)
+		inline, ok := formatInlineList(list)
+		if !isList || !ok {
+			return fmt.Errorf("cannot format table columns at %s", path)
+		}
+		f.buf.WriteString(inner + "columns " + inline + "\n")
+	}
+	if rows, ok := table["rows"]; ok {
+		list, ok := asList(rows)
+		if !ok {
+			return fmt.Errorf("cannot format table rows at %s", path)
+		}
+		f.buf.WriteString(inner + "rows {\n")
+		for i, row := range list {
+			cells, isList := asList(row)
+			inline, ok := formatInlineList(cells)
+			if !isList || !ok {
+				return fmt.Errorf("cannot format table row at %s", path.Key("rows").Index(i))
+			}
+			f.buf.WriteString(f.indent(depth+2) + inline + "\n")
+		}
+		f.buf.WriteString(inner + "}\n")
+	}
+	f.buf.WriteString(indent + "}\n")
+	return nil
+}
+
+// writeScalar writes a scalar value, falling back to a multiline string
+// when the value can't be written on a single line.
+func (f *formatter) writeScalar(head, typ, s, indent string) {
+	if strings.Contains(s, "\n") || needsMultiline(s) {
+		// Numeric annotations dedent multiline content when parsed, so the
+		// content is re-indented to round-trip.
+		pad := ""
+		if n, err := strconv.Atoi(typ); err == nil && n > 0 {
+			pad = strings.Repeat(" ", n)
+		}
+		f.buf.WriteString(head + " ```\n")
+		for _, line := range strings.Split(s, "\n") {
+			f.buf.WriteString(pad + line + "\n")
+		}
+		f.buf.WriteString(indent + "```\n")
+		return
+	}
+
+	switch {
+	case s == "":
+		f.buf.WriteString(head + "\n")
+	case s != strings.TrimSpace(s), strings.HasPrefix(s, "\"") && strings.HasSuffix(s, "\""):
+		f.buf.WriteString(head + " \"" + s + "\"\n")
+	default:
+		f.buf.WriteString(head + " " + s + "\n")
+	}
+}
+
+// needsMultiline reports whether a single-line scalar would be parsed as
+// something other than a string.
+func needsMultiline(s string) bool {
+	trimmed := strings.TrimSpace(s)
+	return strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") ||
+		strings.HasPrefix(trimmed, "```")
+}
+
+// writeBlockBody writes the entries of a block in sorted key order.
+func (f *formatter) writeBlockBody(path Path, block Block, depth int) error {
+	for _, c := range mapChildren(block) {
+		p := path.Key(c.elem.Key)
+		if err := f.writeEntry(p, c.elem.Key, f.doc.annotation(p), c.value, depth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeList writes a multi-line list.
+func (f *formatter) writeList(path Path, head string, list List, depth int) error {
+	indent := f.indent(depth)
+	itemIndent := f.indent(depth + 1)
+
+	f.buf.WriteString(head + " [\n")
+	for i, item := range list {
+		p := path.Index(i)
+		switch v := item.(type) {
+		case string:
+			if !isListItemScalar(v) {
+				return fmt.Errorf("cannot format list item %q at %s", v, p)
+			}
+			f.buf.WriteString(itemIndent + v + "\n")
+		case Block:
+			f.buf.WriteString(itemIndent + "{\n")
+			if err := f.writeBlockBody(p, v, depth+2); err != nil {
+				return err
+			}
+			f.buf.WriteString(itemIndent + "}\n")
+		case map[string]any:
+			block, _ := asMap(v)
+			f.buf.WriteString(itemIndent + "{\n")
+			if err := f.writeBlockBody(p, block, depth+2); err != nil {
+				return err
+			}
+			f.buf.WriteString(itemIndent + "}\n")
+		case List, []any:
+			nested, _ := asList(v)
+			inline, ok := formatInlineList(nested)
+			if !ok {
+				return fmt.Errorf("cannot format nested list at %s", p)
+			}
+			f.buf.WriteString(itemIndent + inline + "\n")
+		default:
+			return fmt.Errorf("cannot format %T at %s", item, p)
+		}
+	}
+	f.buf.WriteString(indent + "]\n")
+	return nil
+}
+
+// isListItemScalar reports whether s can be written as a multi-line list item.
+func isListItemScalar(s string) bool {
+	return s != "" && s == strings.TrimSpace(s) && s != "]" &&
+		!strings.ContainsAny(s, "\n") && !strings.HasPrefix(s, "#") &&
+		!strings.HasPrefix(s, "{") && !strings.HasPrefix(s, "[")
+}
+
+// formatInlineList renders a list of simple scalars as [a, b, c].
+func formatInlineList(list List) (string, bool) {
+	if len(list) == 1 && list[0] == "" {
+		return "", false
+	}
+	items := make([]string, len(list))
+	for i, item := range list {
+		s, ok := item.(string)
+		if !ok || s != strings.TrimSpace(s) || strings.ContainsAny(s, ",[]\n") {
+			return "", false
+		}
+		items[i] = s
+	}
+	return "[" + strings.Join(items, ", ") + "]", true
+}
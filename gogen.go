@@ -0,0 +1,188 @@
+package up
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// GoOptions configures GenerateGo.
+type GoOptions struct {
+	Package   string // Package clause of the generated file
+	TypeName  string // Name of the root struct; defaults to "Config"
+	Generator string // Command named in the "Code generated" header; defaults to "up-gen"
+}
+
+// GenerateGo emits gofmt-formatted Go source declaring structs that
+// Unmarshal can decode documents matching schema into. Blocks with
+// declared fields become named structs, lists become slices of their item
+// type and blocks without declared fields, tables and untyped values
+// become map[string]any or any. Required fields are tagged "required" and
+// optional ones "omitempty". Keys that cannot be written as the name of an
+// up tag, such as keys containing a comma or a quote, are an error.
+func GenerateGo(schema *Schema, opts GoOptions) ([]byte, error) {
+	if opts.Package == "" {
+		return nil, fmt.Errorf("generated Go code needs a package name")
+	}
+	if opts.TypeName == "" {
+		opts.TypeName = "Config"
+	}
+	if opts.Generator == "" {
+		opts.Generator = "up-gen"
+	}
+
+	g := &goGenerator{used: make(map[string]bool)}
+	g.used[opts.TypeName] = true
+	if err := g.writeStruct(opts.TypeName, "is the root of the document.", schema.Fields); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by %s. DO NOT EDIT.\n\npackage %s\n", opts.Generator, opts.Package)
+	for _, decl := range g.decls {
+		buf.WriteString("\n" + decl)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w", err)
+	}
+	return src, nil
+}
+
+// goGenerator accumulates type declarations. Nested structs are declared
+// after the struct that uses them.
+type goGenerator struct {
+	decls []string
+	used  map[string]bool
+}
+
+// writeStruct declares a struct type with one field per schema field.
+func (g *goGenerator) writeStruct(name, doc string, fields []*Field) error {
+	index := len(g.decls)
+	g.decls = append(g.decls, "")
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// %s %s\n", name, doc)
+	fmt.Fprintf(&sb, "type %s struct {\n", name)
+	names := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		fieldName := uniqueName(goName(f.Name), names)
+		if f.Description != "" {
+			for _, line := range strings.Split(f.Description, "\n") {
+				sb.WriteString("// " + line + "\n")
+			}
+		}
+		if err := checkTagKey(f.Name); err != nil {
+			return fmt.Errorf("%s.%s: %w", name, f.Name, err)
+		}
+		tag := f.Name
+		if f.Required {
+			tag += ",required"
+		} else {
+			tag += ",omitempty"
+		}
+		typ, err := g.goType(f, name+fieldName, fmt.Sprintf("%s.%s", name, f.Name))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&sb, "%s %s `up:%s`\n", fieldName, typ, strconv.Quote(tag))
+	}
+	sb.WriteString("}\n")
+	g.decls[index] = sb.String()
+	return nil
+}
+
+// checkTagKey reports an error if key cannot be used as the name in an up
+// tag: backquotes end the tag, quotes and commas change how it is split,
+// and "-" or a leading "default=" are read as options.
+func checkTagKey(key string) error {
+	switch {
+	case strings.ContainsAny(key, "`\","):
+		return fmt.Errorf("key %q cannot be written in a struct tag", key)
+	case key == "-", strings.HasPrefix(key, "default="):
+		return fmt.Errorf("key %q would be read as a tag option", key)
+	}
+	return nil
+}
+
+// goType returns the Go type of a field, declaring a named struct called
+// typeName when the field is a block with declared fields.
+func (g *goGenerator) goType(f *Field, typeName, location string) (string, error) {
+	switch f.kind() {
+	case "string":
+		return "string", nil
+	case "int":
+		return "int", nil
+	case "float":
+		return "float64", nil
+	case "bool":
+		return "bool", nil
+	case "block":
+		if f.Fields == nil {
+			return "map[string]any", nil
+		}
+		name := uniqueName(typeName, g.used)
+		if err := g.writeStruct(name, "is the type of "+location+".", f.Fields); err != nil {
+			return "", err
+		}
+		return name, nil
+	case "list":
+		if f.Items == nil {
+			return "[]any", nil
+		}
+		item, err := g.goType(f.Items, typeName+"Item", location+" items")
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	case "table":
+		return "map[string]any", nil
+	default:
+		return "any", nil
+	}
+}
+
+// goInitialisms are name parts written in upper case, following Go naming
+// conventions.
+var goInitialisms = map[string]bool{
+	"api": true, "dns": true, "html": true, "http": true, "https": true, "id": true,
+	"ip": true, "json": true, "sql": true, "ssh": true, "tcp": true, "tls": true,
+	"ttl": true, "udp": true, "ui": true, "uri": true, "url": true, "uuid": true,
+}
+
+// goName converts a UP key such as "max-conns" or "api_url" into an
+// exported Go identifier ("MaxConns", "APIURL").
+func goName(key string) string {
+	parts := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var sb strings.Builder
+	for _, part := range parts {
+		if goInitialisms[strings.ToLower(part)] {
+			sb.WriteString(strings.ToUpper(part))
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		sb.WriteString(string(runes))
+	}
+	name := sb.String()
+	if name == "" || !unicode.IsLetter([]rune(name)[0]) {
+		name = "X" + name
+	}
+	return name
+}
+
+// uniqueName returns name, or name with a numeric suffix if it is already
+// used, and marks the result as used.
+func uniqueName(name string, used map[string]bool) string {
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = name + strconv.Itoa(i)
+	}
+	used[candidate] = true
+	return candidate
+}
@@ -0,0 +1,104 @@
+package up
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateGo(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(`name string
+port!int {
+  required false
+  description Port to listen on
+}
+api-url {
+  type string
+  required false
+}
+server {
+  fields {
+    tls!bool {
+      required false
+    }
+  }
+}
+routes {
+  items {
+    fields {
+      path string
+    }
+  }
+}
+labels {
+  type block
+  required false
+}
+tags {
+  items float
+  required false
+}
+`))
+	if err != nil {
+		t.Fatalf("ParseSchema() failed: %v", err)
+	}
+
+	src, err := GenerateGo(schema, GoOptions{Package: "config"})
+	if err != nil {
+		t.Fatalf("GenerateGo() failed: %v", err)
+	}
+
+	expected := "// Code generated by up-gen. DO NOT EDIT.\n" + `
+package config
+
+// Config is the root of the document.
+type Config struct {
+	Name string ` + "`up:\"name,required\"`" + `
+	// Port to listen on
+	Port   int                ` + "`up:\"port,omitempty\"`" + `
+	APIURL string             ` + "`up:\"api-url,omitempty\"`" + `
+	Server ConfigServer       ` + "`up:\"server,required\"`" + `
+	Routes []ConfigRoutesItem ` + "`up:\"routes,required\"`" + `
+	Labels map[string]any     ` + "`up:\"labels,omitempty\"`" + `
+	Tags   []float64          ` + "`up:\"tags,omitempty\"`" + `
+}
+
+// ConfigServer is the type of Config.server.
+type ConfigServer struct {
+	TLS bool ` + "`up:\"tls,omitempty\"`" + `
+}
+
+// ConfigRoutesItem is the type of Config.routes items.
+type ConfigRoutesItem struct {
+	Path string ` + "`up:\"path,required\"`" + `
+}
+`
+	if string(src) != expected {
+		t.Errorf("Generated code mismatch:\nexpected:\n%s\ngot:\n%s", expected, src)
+	}
+
+	if _, err := GenerateGo(schema, GoOptions{}); err == nil {
+		t.Error("Expected error without a package name")
+	}
+
+	for _, key := range []string{"a`b", `a"b`, "a,b", "-", "default=1"} {
+		nested := &Schema{Fields: []*Field{{Name: "server", Fields: []*Field{{Name: key, Type: "string"}}}}}
+		if _, err := GenerateGo(nested, GoOptions{Package: "config"}); err == nil {
+			t.Errorf("Expected error for key %q", key)
+		}
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"name":      "Name",
+		"max-conns": "MaxConns",
+		"api_url":   "APIURL",
+		"user.id":   "UserID",
+		"2fa":       "X2fa",
+	}
+	for key, want := range tests {
+		if got := goName(key); got != want {
+			t.Errorf("goName(%q): expected %q, got %q", key, want, got)
+		}
+	}
+}
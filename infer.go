@@ -0,0 +1,278 @@
+package up
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// maxEnumValues is the largest number of distinct values InferSchema turns
+// into an enum.
+const maxEnumValues = 5
+
+// InferSchema derives a schema from sample documents. Scalar types come
+// from type annotations or, for unannotated values, from their shape
+// (integers, decimals and true/false). Blocks, list items and table
+// columns are described recursively, and a key is required when it is
+// present in every sample that contains its parent. String fields that
+// take at most five distinct values, at least one of them repeated, get
+// those values as an enum. The result is meant as a starting point to be
+// tightened by hand.
+func InferSchema(docs ...*Document) *Schema {
+	schema := &Schema{}
+	index := make(map[string]int)
+	for n, doc := range docs {
+		seen := make(map[string]bool)
+		for _, node := range doc.Nodes {
+			if seen[node.Key] {
+				continue
+			}
+			seen[node.Key] = true
+			f := inferField(doc, Path{{Key: node.Key}}, node.Key, node.Value)
+			if i, ok := index[node.Key]; ok {
+				schema.Fields[i] = mergeFields(schema.Fields[i], f)
+				continue
+			}
+			// Keys missing from earlier samples are optional.
+			f.Required = n == 0
+			index[node.Key] = len(schema.Fields)
+			schema.Fields = append(schema.Fields, f)
+		}
+		for _, f := range schema.Fields {
+			if !seen[f.Name] {
+				f.Required = false
+			}
+		}
+	}
+
+	for _, f := range schema.Fields {
+		inferEnums(f)
+	}
+	return schema
+}
+
+// inferField describes a single observed value located at path.
+func inferField(doc *Document, path Path, name string, value Value) *Field {
+	f := &Field{Name: name, Required: true}
+	switch v := value.(type) {
+	case string:
+		f.Type = scalarKind(doc.annotation(path), v)
+		if v != "" {
+			f.samples = map[string]int{v: 1}
+		}
+	case Block, map[string]any:
+		if isTableValue(doc, path, v) {
+			f.Type = "table"
+			f.Columns = inferColumns(doc, path, v)
+			break
+		}
+		block, _ := asMap(v)
+		f.Type = "block"
+		f.Fields = make([]*Field, 0, len(block))
+		for _, c := range mapChildren(block) {
+			f.Fields = append(f.Fields, inferField(doc, path.Key(c.elem.Key), c.elem.Key, c.value))
+		}
+	case List, []any:
+		list, _ := asList(v)
+		f.Type = "list"
+		for i, item := range list {
+			items := inferField(doc, path.Index(i), "", item)
+			if f.Items == nil {
+				f.Items = items
+				continue
+			}
+			f.Items = mergeFields(f.Items, items)
+		}
+	default:
+		f.Type = "any"
+	}
+	return f
+}
+
+// inferColumns describes the columns of a table value from its cells.
+func inferColumns(doc *Document, path Path, value Value) []*Field {
+	table, _ := asMap(value)
+	names, _ := asList(table["columns"])
+	rows, _ := asList(table["rows"])
+
+	columns := make([]*Field, len(names))
+	for i, name := range names {
+		col := &Field{Name: fmt.Sprint(name), Required: true}
+		for r, row := range rows {
+			cells, _ := asList(row)
+			if i >= len(cells) {
+				continue
+			}
+			cell := inferField(doc, path.Key("rows").Index(r).Index(i), col.Name, cells[i])
+			if col.Type == "" {
+				col = cell
+				continue
+			}
+			col = mergeFields(col, cell)
+		}
+		if col.Type == "" {
+			col.Type = "string"
+		}
+		columns[i] = col
+	}
+	return columns
+}
+
+// scalarKind returns the schema type of a scalar, preferring its type
+// annotation and otherwise judging by its shape.
+func scalarKind(annotation, s string) string {
+	if t, ok := schemaTypes[annotation]; ok && isScalarKind(t) {
+		return t
+	}
+	if annotation != "" {
+		return "string"
+	}
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return "int"
+	}
+	// ParseFloat also accepts "NaN" and "Inf", which are better left strings.
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return "float"
+	}
+	if s == "true" || s == "false" {
+		return "bool"
+	}
+	return "string"
+}
+
+// mergeFields combines two observations of the same field. Differing
+// scalar types widen to float (int and float) or string, and otherwise
+// to any.
+func mergeFields(a, b *Field) *Field {
+	f := &Field{Name: a.Name, Type: a.Type, Required: a.Required && b.Required}
+	if a.Type != b.Type {
+		switch {
+		case isNumericKind(a.Type) && isNumericKind(b.Type):
+			f.Type = "float"
+		case isScalarKind(a.Type) && isScalarKind(b.Type):
+			f.Type = "string"
+			f.samples = mergeSamples(a.samples, b.samples)
+		default:
+			f.Type = "any"
+		}
+		return f
+	}
+
+	switch f.Type {
+	case "block":
+		f.Fields = mergeFieldLists(a.Fields, b.Fields)
+	case "table":
+		f.Columns = mergeFieldLists(a.Columns, b.Columns)
+	case "list":
+		switch {
+		case a.Items == nil:
+			f.Items = b.Items
+		case b.Items == nil:
+			f.Items = a.Items
+		default:
+			f.Items = mergeFields(a.Items, b.Items)
+		}
+	default:
+		f.samples = mergeSamples(a.samples, b.samples)
+	}
+	return f
+}
+
+// mergeFieldLists merges the fields of two observed blocks. Fields missing
+// from either block become optional.
+func mergeFieldLists(a, b []*Field) []*Field {
+	byName := make(map[string]*Field, len(b))
+	for _, f := range b {
+		byName[f.Name] = f
+	}
+
+	merged := make([]*Field, 0, len(a)+len(b))
+	seen := make(map[string]bool, len(a))
+	for _, f := range a {
+		seen[f.Name] = true
+		if other, ok := byName[f.Name]; ok {
+			merged = append(merged, mergeFields(f, other))
+			continue
+		}
+		optional := *f
+		optional.Required = false
+		merged = append(merged, &optional)
+	}
+	for _, f := range b {
+		if !seen[f.Name] {
+			optional := *f
+			optional.Required = false
+			merged = append(merged, &optional)
+		}
+	}
+	return merged
+}
+
+// mergeSamples adds up the observed value counts of two fields. A nil side
+// has no observations, such as an empty string, and leaves the other side
+// as is. Once there are too many values to form an enum, tracking stops for
+// good, which is recorded as an empty map.
+func mergeSamples(a, b map[string]int) map[string]int {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case len(a) == 0 || len(b) == 0:
+		return map[string]int{}
+	}
+	merged := make(map[string]int, len(a)+len(b))
+	for v, n := range a {
+		merged[v] += n
+	}
+	for v, n := range b {
+		merged[v] += n
+	}
+	if len(merged) > maxEnumValues {
+		return map[string]int{}
+	}
+	return merged
+}
+
+// inferEnums turns the observed values of string fields into enums and
+// discards the observations.
+func inferEnums(f *Field) {
+	if f.Type == "string" && len(f.samples) > 0 && len(f.samples) <= maxEnumValues {
+		total := 0
+		for _, n := range f.samples {
+			total += n
+		}
+		if total > len(f.samples) {
+			for v := range f.samples {
+				f.Enum = append(f.Enum, v)
+			}
+			sort.Strings(f.Enum)
+		}
+	}
+	f.samples = nil
+
+	for _, child := range f.Fields {
+		inferEnums(child)
+	}
+	for _, col := range f.Columns {
+		inferEnums(col)
+	}
+	if f.Items != nil {
+		inferEnums(f.Items)
+	}
+}
+
+// isScalarKind reports whether kind is one of the scalar schema types.
+func isScalarKind(kind string) bool {
+	switch kind {
+	case "string", "int", "float", "bool":
+		return true
+	}
+	return false
+}
+
+// isNumericKind reports whether kind is int or float.
+func isNumericKind(kind string) bool {
+	return kind == "int" || kind == "float"
+}
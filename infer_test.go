@@ -0,0 +1,186 @@
+package up
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInferSchema(t *testing.T) {
+	samples := []string{
+		`name demo
+port!int 8080
+server {
+  host a
+  tls!bool true
+}
+hosts [
+  {
+    name web
+  }
+]
+`,
+		`name other
+ratio!float 0.5
+port!float 80.5
+server {
+  host b
+}
+`,
+	}
+
+	docs := make([]*Document, len(samples))
+	for i, s := range samples {
+		doc, err := NewParser().ParseDocument(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("ParseDocument() failed: %v", err)
+		}
+		docs[i] = doc
+	}
+
+	out, err := Format(InferSchema(docs...).Document())
+	if err != nil {
+		t.Fatalf("Format() failed: %v", err)
+	}
+
+	expected := `name string
+port float
+server {
+  fields {
+    host string
+    tls {
+      required false
+      type bool
+    }
+  }
+}
+hosts {
+  items {
+    fields {
+      name string
+    }
+  }
+  required false
+}
+ratio {
+  required false
+  type float
+}
+`
+	if string(out) != expected {
+		t.Errorf("Inferred schema mismatch:\nexpected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	for i, doc := range docs {
+		if violations := Validate(doc, InferSchema(docs...)); violations != nil {
+			t.Errorf("Sample %d does not validate:\n%s", i, violations)
+		}
+	}
+}
+
+func TestInferSchema_ShapesEnumsAndTables(t *testing.T) {
+	samples := []string{
+		`mode prod
+replicas 3
+ratio 0.25
+debug false
+version v1
+hosts!table {
+  columns [name, port]
+  rows {
+    [web, 80]
+    [db, 5432]
+  }
+}
+`,
+		`mode dev
+replicas 5
+ratio 1
+debug true
+version v2
+hosts!table {
+  columns [name, port, weight]
+  rows {
+    [api, 8080, 0.5]
+  }
+}
+`,
+		`mode prod
+replicas many
+debug true
+version v3
+`,
+	}
+
+	docs := make([]*Document, len(samples))
+	for i, s := range samples {
+		doc, err := NewParser().ParseDocument(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("ParseDocument() failed: %v", err)
+		}
+		docs[i] = doc
+	}
+
+	schema := InferSchema(docs...)
+	out, err := Format(schema.Document())
+	if err != nil {
+		t.Fatalf("Format() failed: %v", err)
+	}
+
+	expected := `mode {
+  enum [dev, prod]
+  type string
+}
+replicas string
+ratio {
+  required false
+  type float
+}
+debug bool
+version string
+hosts {
+  columns {
+    name string
+    port int
+    weight {
+      required false
+      type float
+    }
+  }
+  required false
+}
+`
+	if string(out) != expected {
+		t.Errorf("Inferred schema mismatch:\nexpected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	reparsed, err := ParseSchema(strings.NewReader(string(out)))
+	if err != nil {
+		t.Fatalf("ParseSchema() failed: %v", err)
+	}
+	for i, doc := range docs {
+		if violations := Validate(doc, reparsed); violations != nil {
+			t.Errorf("Sample %d does not validate:\n%s", i, violations)
+		}
+	}
+}
+
+func TestInferSchema_EmptyValuesAndSpecialFloats(t *testing.T) {
+	var docs []*Document
+	for _, s := range []string{"mode prod\nlimit NaN\n", "mode\nlimit -Inf\n", "mode prod\nlimit 1\n", "mode dev\nlimit 2.5\n"} {
+		doc, err := NewParser().ParseDocument(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("ParseDocument() failed: %v", err)
+		}
+		docs = append(docs, doc)
+	}
+
+	schema := InferSchema(docs...)
+	mode, limit := schema.Fields[0], schema.Fields[1]
+	// An empty value carries no information about the enum
+	if strings.Join(mode.Enum, ",") != "dev,prod" {
+		t.Errorf("Expected mode enum [dev, prod], got %v", mode.Enum)
+	}
+	if limit.Type != "string" {
+		t.Errorf("Expected NaN and Inf to be strings, got type %s", limit.Type)
+	}
+}
@@ -0,0 +1,67 @@
+package up
+
+import (
+	"iter"
+)
+
+// All returns an iterator over the top-level keys and values of the
+// document in document order.
+func (d *Document) All() iter.Seq2[string, Value] {
+	return func(yield func(string, Value) bool) {
+		for _, node := range d.Nodes {
+			if !yield(node.Key, node.Value) {
+				return
+			}
+		}
+	}
+}
+
+// Leaves returns an iterator over every scalar value in the document and
+// its path, in the order visited by Walk. Empty blocks and lists yield
+// nothing. The document is only read, so several goroutines may range over
+// it at once.
+func (d *Document) Leaves() iter.Seq2[Path, Value] {
+	return func(yield func(Path, Value) bool) {
+		_ = Walk(d, func(c *Cursor) error {
+			if isContainer(c.Value) {
+				return nil
+			}
+			if !yield(c.Path, c.Value) {
+				return SkipAll
+			}
+			return nil
+		})
+	}
+}
+
+// Sorted returns an iterator over the entries of the block in sorted key
+// order.
+func (b Block) Sorted() iter.Seq2[string, Value] {
+	return func(yield func(string, Value) bool) {
+		for _, c := range mapChildren(b) {
+			if !yield(c.elem.Key, c.value) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over the indexes and items of the list.
+func (l List) All() iter.Seq2[int, Value] {
+	return func(yield func(int, Value) bool) {
+		for i, item := range l {
+			if !yield(i, item) {
+				return
+			}
+		}
+	}
+}
+
+// isContainer reports whether v is a block, table or list.
+func isContainer(v Value) bool {
+	switch v.(type) {
+	case Block, map[string]any, List, []any:
+		return true
+	}
+	return false
+}
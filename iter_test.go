@@ -0,0 +1,79 @@
+package up
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDocumentIterators(t *testing.T) {
+	doc, err := NewParser().ParseDocument(strings.NewReader(`b 1
+a {
+z 2
+y [x, w]
+empty {
+}
+}
+`))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	var keys []string
+	for key := range doc.All() {
+		keys = append(keys, key)
+	}
+	if strings.Join(keys, ",") != "b,a" {
+		t.Errorf("All() keys: %v", keys)
+	}
+
+	var leaves []string
+	for path, value := range doc.Leaves() {
+		leaves = append(leaves, path.String()+"="+value.(string))
+	}
+	if strings.Join(leaves, " ") != "b=1 a.y[0]=x a.y[1]=w a.z=2" {
+		t.Errorf("Leaves(): %v", leaves)
+	}
+
+	var first []string
+	for path := range doc.Leaves() {
+		first = append(first, path.String())
+		break
+	}
+	if len(first) != 1 {
+		t.Errorf("Leaves() did not stop early: %v", first)
+	}
+
+	block, _ := doc.Get("a")
+	var sorted []string
+	for key := range block.(Block).Sorted() {
+		sorted = append(sorted, key)
+	}
+	if strings.Join(sorted, ",") != "empty,y,z" {
+		t.Errorf("Sorted() keys: %v", sorted)
+	}
+}
+
+func TestDocumentLeavesConcurrent(t *testing.T) {
+	doc, err := NewParser().ParseDocument(strings.NewReader(walkTestDoc))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	// Ranging over a document does not modify it, so concurrent readers
+	// are safe; run with -race to check.
+	counts := make(chan int)
+	for i := 0; i < 4; i++ {
+		go func() {
+			n := 0
+			for range doc.Leaves() {
+				n++
+			}
+			counts <- n
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if n := <-counts; n != 6 {
+			t.Errorf("Expected 6 leaves, got %d", n)
+		}
+	}
+}
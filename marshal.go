@@ -0,0 +1,341 @@
+package up
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Marshaler is implemented by types that encode themselves as a UP value.
+// MarshalUP returns the value (a string, Block or List) and its type
+// annotation, or "" for none.
+type Marshaler interface {
+	MarshalUP() (value Value, typ string, err error)
+}
+
+// Marshal returns the UP encoding of v, which must be a struct, a pointer
+// to a struct or a map with string keys. It is the counterpart of
+// Unmarshal and honors the same struct tags:
+//   - `up:"fieldname"` - writes the field under key "fieldname"
+//   - `up:"fieldname,omitempty"` - skips the field if it has an empty value
+//   - `up:"-"` - never writes the field
+//   - `up:",inline"` and `up:",remain"` - write the entries of the struct or
+//     map into the enclosing block
+//
+// Untagged fields use their lower-cased name; use an Encoder with
+// SetNaming for other conventions. Struct fields are written in
+// declaration order and map entries in sorted key order. Integers, floats
+// and booleans are annotated with their type (port!int 8080), nested
+// structs and maps become blocks, slices and arrays become lists and
+// strings containing newlines become multiline values. Nil pointers and
+// interfaces are skipped. Types implementing Marshaler or
+// encoding.TextMarshaler encode themselves.
+func Marshal(v any) ([]byte, error) {
+	doc, err := MarshalDocument(v)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := doc.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalDocument converts v into a Document; see Marshal.
+func MarshalDocument(v any) (*Document, error) {
+	return (&encodeState{annotate: true}).marshalDocument(v)
+}
+
+// marshalDocument converts v into a Document.
+func (e *encodeState) marshalDocument(v any) (*Document, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("cannot marshal nil %s", rv.Type())
+		}
+		rv = rv.Elem()
+	}
+
+	doc := &Document{Nodes: []Node{}}
+	e.doc = doc
+
+	var entries []marshalEntry
+	var err error
+	switch rv.Kind() {
+	case reflect.Struct:
+		entries, err = e.structEntries(nil, rv)
+	case reflect.Map:
+		entries, err = e.mapEntries(nil, rv)
+	default:
+		return nil, fmt.Errorf("cannot marshal %v: must be a struct or a map with string keys", rv.Kind())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		doc.Nodes = append(doc.Nodes, Node{Key: entry.key, Type: entry.typ, Value: entry.value})
+	}
+	return doc, nil
+}
+
+// encodeState holds the options and the document of a single encoding run.
+type encodeState struct {
+	doc      *Document
+	annotate bool           // write type annotations for scalars
+	naming   NamingStrategy // key of untagged fields
+}
+
+// marshalEntry is an encoded struct field or map entry.
+type marshalEntry struct {
+	key   string
+	typ   string
+	value Value
+}
+
+// structEntries encodes the fields of a struct located at path, in
+// declaration order. Inlined structs and ",remain" maps contribute their
+// entries in place; if a key occurs more than once, the first entry wins.
+func (e *encodeState) structEntries(path Path, rv reflect.Value) ([]marshalEntry, error) {
+	t := rv.Type()
+	entries := make([]marshalEntry, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("up")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+		fv := rv.Field(i)
+
+		if isInline(field, name, opts) || (hasOption(opts, "remain") && field.IsExported()) {
+			inner, err := e.inlineEntries(path, fv)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, inner...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = e.naming.key(field.Name)
+		}
+
+		if hasOption(opts, "omitempty") && isEmptyValue(fv) {
+			continue
+		}
+		entry, ok, err := e.entry(path.Key(name), name, fv)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	seen := make(map[string]bool, len(entries))
+	unique := entries[:0]
+	for _, entry := range entries {
+		if !seen[entry.key] {
+			seen[entry.key] = true
+			unique = append(unique, entry)
+		}
+	}
+	return unique, nil
+}
+
+// inlineEntries encodes the entries of an inlined struct or ",remain" map
+// as part of the enclosing block.
+func (e *encodeState) inlineEntries(path Path, rv reflect.Value) ([]marshalEntry, error) {
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() == reflect.Map {
+		return e.mapEntries(path, rv)
+	}
+	return e.structEntries(path, rv)
+}
+
+// mapEntries encodes the entries of a map located at path, in sorted key
+// order.
+func (e *encodeState) mapEntries(path Path, rv reflect.Value) ([]marshalEntry, error) {
+	if rv.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("%s: map keys must be strings, got %s", displayPath(path), rv.Type().Key())
+	}
+	keys := make([]string, 0, rv.Len())
+	for _, k := range rv.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+
+	entries := make([]marshalEntry, 0, len(keys))
+	for _, key := range keys {
+		entry, ok, err := e.entry(path.Key(key), key, rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// entry encodes a keyed value. It reports false for nil values, which are
+// not written.
+func (e *encodeState) entry(path Path, key string, rv reflect.Value) (marshalEntry, bool, error) {
+	value, typ, err := e.value(path, rv)
+	if err != nil || value == nil {
+		return marshalEntry{}, false, err
+	}
+	return marshalEntry{key: key, typ: typ, value: value}, true, nil
+}
+
+// value encodes rv located at path and returns the UP value along with its
+// type annotation. Nested annotations are recorded on the document; the
+// caller records the annotation of the value itself.
+func (e *encodeState) value(path Path, rv reflect.Value) (Value, string, error) {
+	for {
+		if handled, value := marshalBuiltin(rv); handled {
+			return value, "", nil
+		}
+		if handled, value, typ, err := marshalCustom(path, rv); handled {
+			return value, typ, err
+		}
+		if rv.Kind() != reflect.Ptr && rv.Kind() != reflect.Interface {
+			break
+		}
+		if rv.IsNil() {
+			return nil, "", nil
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), "", nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), e.annotation("bool"), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), e.annotation("int"), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), e.annotation("int"), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, rv.Type().Bits()), e.annotation("float"), nil
+	case reflect.Struct:
+		entries, err := e.structEntries(path, rv)
+		if err != nil {
+			return nil, "", err
+		}
+		return e.block(path, entries), "", nil
+	case reflect.Map:
+		entries, err := e.mapEntries(path, rv)
+		if err != nil {
+			return nil, "", err
+		}
+		return e.block(path, entries), "", nil
+	case reflect.Slice, reflect.Array:
+		list := make(List, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			p := path.Index(len(list))
+			item, typ, err := e.value(p, rv.Index(i))
+			if err != nil {
+				return nil, "", err
+			}
+			if item == nil {
+				continue
+			}
+			list = append(list, item)
+			e.doc.setAnnotation(p, typ)
+		}
+		return list, "", nil
+	default:
+		return nil, "", fmt.Errorf("%s: cannot marshal %s", displayPath(path), rv.Type())
+	}
+}
+
+// marshalCustom encodes rv with its Marshaler or encoding.TextMarshaler
+// implementation. It reports whether rv implements either interface.
+func marshalCustom(path Path, rv reflect.Value) (bool, Value, string, error) {
+	if (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && rv.IsNil() {
+		return false, nil, "", nil
+	}
+
+	var v any
+	switch {
+	case rv.Kind() != reflect.Interface && rv.CanAddr():
+		v = rv.Addr().Interface()
+	case rv.CanInterface():
+		v = rv.Interface()
+	default:
+		return false, nil, "", nil
+	}
+
+	switch m := v.(type) {
+	case Marshaler:
+		value, typ, err := m.MarshalUP()
+		if err != nil {
+			return true, nil, "", fmt.Errorf("%s: %w", displayPath(path), err)
+		}
+		return true, value, typ, nil
+	case encoding.TextMarshaler:
+		text, err := m.MarshalText()
+		if err != nil {
+			return true, nil, "", fmt.Errorf("%s: %w", displayPath(path), err)
+		}
+		return true, string(text), "", nil
+	}
+	return false, nil, "", nil
+}
+
+// annotation returns typ if type annotations are enabled.
+func (e *encodeState) annotation(typ string) string {
+	if !e.annotate {
+		return ""
+	}
+	return typ
+}
+
+// block builds a block from encoded entries and records their annotations.
+func (e *encodeState) block(path Path, entries []marshalEntry) Block {
+	block := make(Block, len(entries))
+	for _, entry := range entries {
+		block[entry.key] = entry.value
+		e.doc.setAnnotation(path.Key(entry.key), entry.typ)
+	}
+	return block
+}
+
+// isEmptyValue reports whether rv is empty for the purposes of omitempty:
+// false, zero numbers, empty strings, slices and maps, and nil pointers
+// and interfaces.
+func isEmptyValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	case reflect.Struct:
+		return false
+	default:
+		return rv.IsZero()
+	}
+}
+
+// displayPath renders a path for error messages, using "document" for the
+// root.
+func displayPath(path Path) string {
+	if len(path) == 0 {
+		return "document"
+	}
+	return path.String()
+}
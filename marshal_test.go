@@ -0,0 +1,119 @@
+package up
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type marshalTestConfig struct {
+	Name     string            `up:"name"`
+	Port     int               `up:"port"`
+	Ratio    float64           `up:"ratio,omitempty"`
+	Debug    bool              `up:"debug"`
+	Script   string            `up:"script"`
+	Tags     []string          `up:"tags"`
+	Labels   map[string]string `up:"labels,omitempty"`
+	Internal string            `up:"-"`
+	Timeout  *int              `up:"timeout"`
+	Database struct {
+		Host string `up:"host"`
+		Pool uint8  `up:"pool"`
+	} `up:"database"`
+	Routes []marshalTestRoute `up:"routes"`
+}
+
+type marshalTestRoute struct {
+	Path   string
+	Weight float64
+}
+
+func TestMarshal(t *testing.T) {
+	cfg := marshalTestConfig{
+		Name:     "demo",
+		Port:     8080,
+		Debug:    true,
+		Script:   "echo one\necho two",
+		Tags:     []string{"a", "b"},
+		Labels:   map[string]string{"team": "core", "env": "prod"},
+		Internal: "hidden",
+	}
+	cfg.Database.Host = "db.local"
+	cfg.Database.Pool = 4
+	cfg.Routes = []marshalTestRoute{{Path: "/", Weight: 0.5}}
+
+	data, err := Marshal(&cfg)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+
+	expected := "name demo\n" +
+		"port!int 8080\n" +
+		"debug!bool true\n" +
+		"script ```\n" +
+		"echo one\n" +
+		"echo two\n" +
+		"```\n" +
+		"tags [\n" +
+		"  a\n" +
+		"  b\n" +
+		"]\n" +
+		"labels {\n" +
+		"  env prod\n" +
+		"  team core\n" +
+		"}\n" +
+		"database {\n" +
+		"  host db.local\n" +
+		"  pool!int 4\n" +
+		"}\n" +
+		"routes [\n" +
+		"  {\n" +
+		"    path /\n" +
+		"    weight!float 0.5\n" +
+		"  }\n" +
+		"]\n"
+	if string(data) != expected {
+		t.Errorf("Marshal() mismatch:\nexpected:\n%s\ngot:\n%s", expected, data)
+	}
+
+	var decoded marshalTestConfig
+	if err := Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	cfg.Internal = ""
+	if !reflect.DeepEqual(decoded, cfg) {
+		t.Errorf("Round trip mismatch:\nexpected: %+v\ngot:      %+v", cfg, decoded)
+	}
+}
+
+func TestMarshalDocument(t *testing.T) {
+	doc, err := MarshalDocument(map[string]any{
+		"b": []int{1, 2},
+		"a": map[string]any{"on": false},
+	})
+	if err != nil {
+		t.Fatalf("MarshalDocument() failed: %v", err)
+	}
+
+	if nodeKeys(doc) != "a,b" {
+		t.Errorf("Expected sorted keys a,b, got %s", nodeKeys(doc))
+	}
+	if doc.Annotation("a.on") != "bool" || doc.Annotation("b[1]") != "int" {
+		t.Errorf("Missing annotations: a.on=%q b[1]=%q", doc.Annotation("a.on"), doc.Annotation("b[1]"))
+	}
+
+	tests := []struct {
+		value any
+		want  string
+	}{
+		{42, "must be a struct or a map"},
+		{(*marshalTestConfig)(nil), "cannot marshal nil"},
+		{map[string]any{"ch": make(chan int)}, "ch: cannot marshal chan int"},
+		{map[int]string{1: "x"}, "map keys must be strings"},
+	}
+	for _, tt := range tests {
+		if _, err := MarshalDocument(tt.value); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("MarshalDocument(%T): expected error containing %q, got %v", tt.value, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package up
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Conflict describes a path that both sides changed in incompatible ways.
+// A nil value means the key is absent on that side.
+type Conflict struct {
+	Path   Path
+	Type   bool // The conflict is between type annotations rather than values
+	Base   Value
+	Ours   Value
+	Theirs Value
+}
+
+// String renders the conflict on a single line.
+func (c Conflict) String() string {
+	render := func(v Value) string {
+		if v == nil {
+			return "(absent)"
+		}
+		if c.Type {
+			return formatDiffType(v.(string))
+		}
+		return formatDiffValue(v)
+	}
+	kind := "value"
+	if c.Type {
+		kind = "type"
+	}
+	return fmt.Sprintf("%s: %s conflict: ours %s, theirs %s (base %s)",
+		c.Path, kind, render(c.Ours), render(c.Theirs), render(c.Base))
+}
+
+// MergeResult is the outcome of Merge3.
+type MergeResult struct {
+	Document  *Document  // Merged document; conflicting paths keep our value
+	Conflicts []Conflict // Conflicts in document order
+}
+
+// Merge3 performs a three-way merge of two documents derived from base.
+// Changes made on only one side are applied, identical changes on both
+// sides are applied once, blocks are merged key by key and lists element
+// by element (or by concatenating items appended on both sides). Paths
+// changed differently on both sides are reported as conflicts.
+//
+// Top-level nodes keep our order, followed by nodes added by theirs.
+func Merge3(base, ours, theirs *Document) *MergeResult {
+	m := &merger{
+		base:   base,
+		ours:   ours,
+		theirs: theirs,
+		result: &Document{Nodes: []Node{}},
+	}
+
+	seen := make(map[string]bool)
+	mergeNode := func(key string) {
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		path := Path{{Key: key}}
+
+		b, _ := lookupPath(base, path)
+		o, _ := lookupPath(ours, path)
+		t, _ := lookupPath(theirs, path)
+		merged := m.mergeValue(path, b, o, t)
+		if merged == nil {
+			return
+		}
+		typ := m.mergeAnnotation(path)
+		m.result.Nodes = append(m.result.Nodes, Node{Key: key, Type: typ, Value: merged})
+	}
+
+	for _, node := range ours.Nodes {
+		mergeNode(node.Key)
+	}
+	for _, node := range theirs.Nodes {
+		mergeNode(node.Key)
+	}
+
+	m.result.Directives = mergeDirectives(base.Directives, ours.Directives, theirs.Directives)
+
+	return &MergeResult{Document: m.result, Conflicts: m.conflicts}
+}
+
+// HasConflicts reports whether the merge produced any conflicts.
+func (r *MergeResult) HasConflicts() bool {
+	return len(r.Conflicts) > 0
+}
+
+// merger holds state for a three-way merge.
+type merger struct {
+	base, ours, theirs *Document
+	result             *Document
+	conflicts          []Conflict
+}
+
+// mergeValue merges the values found at path on each side; nil means
+// absent. It returns the merged value, or nil if the key should be absent.
+func (m *merger) mergeValue(path Path, b, o, t Value) Value {
+	switch {
+	case Equal(o, t):
+		m.mergeAnnotations(path)
+		return o
+	case Equal(b, o):
+		m.mergeAnnotations(path)
+		return t
+	case Equal(b, t):
+		m.mergeAnnotations(path)
+		return o
+	}
+
+	// Both sides changed: merge structurally where possible.
+	mo, oIsMap := asMap(o)
+	mt, tIsMap := asMap(t)
+	mb, bIsMap := asMap(b)
+	if oIsMap && tIsMap && (bIsMap || b == nil) {
+		result := make(Block)
+		for _, key := range unionKeys(mb, mo, mt) {
+			p := path.Key(key)
+			if v := m.mergeValue(p, mb[key], mo[key], mt[key]); v != nil {
+				result[key] = v
+				m.result.setAnnotation(p, m.mergeAnnotation(p))
+			}
+		}
+		return result
+	}
+
+	lo, oIsList := asList(o)
+	lt, tIsList := asList(t)
+	lb, bIsList := asList(b)
+	if oIsList && tIsList && bIsList {
+		if len(lo) == len(lb) && len(lt) == len(lb) {
+			result := make(List, len(lb))
+			for i := range lb {
+				p := path.Index(i)
+				result[i] = m.mergeValue(p, lb[i], lo[i], lt[i])
+				m.result.setAnnotation(p, m.mergeAnnotation(p))
+			}
+			return result
+		}
+		if hasListPrefix(lo, lb) && hasListPrefix(lt, lb) {
+			ourItems, theirItems := lo[len(lb):], lt[len(lb):]
+			for i := range lb {
+				p := path.Index(i)
+				m.result.setAnnotation(p, m.mergeAnnotation(p))
+				m.mergeAnnotations(p)
+			}
+			for i := len(lb); i < len(lo); i++ {
+				m.copyAnnotations(m.ours, path.Index(i))
+			}
+			result := append(List{}, lo...)
+			if !Equal(ourItems, theirItems) {
+				// Their items follow ours, so their annotations move along
+				for i := len(lb); i < len(lt); i++ {
+					m.copyAnnotationsTo(m.theirs, path.Index(i), path.Index(len(result)+i-len(lb)))
+				}
+				result = append(result, theirItems...)
+			}
+			return result
+		}
+	}
+
+	m.conflicts = append(m.conflicts, Conflict{Path: path, Base: b, Ours: o, Theirs: t})
+	m.copyAnnotations(m.ours, path)
+	return o
+}
+
+// mergeAnnotation merges the type annotations at path.
+func (m *merger) mergeAnnotation(path Path) string {
+	b, o, t := m.base.annotation(path), m.ours.annotation(path), m.theirs.annotation(path)
+	switch {
+	case o == t, b == t:
+		return o
+	case b == o:
+		return t
+	}
+	m.conflicts = append(m.conflicts, Conflict{Path: path, Type: true, Base: b, Ours: o, Theirs: t})
+	return o
+}
+
+// mergeAnnotations merges the annotations of every path below path that is
+// annotated on any side. Equal values may still carry different types, so
+// each one is merged three ways; path itself is merged by the caller.
+func (m *merger) mergeAnnotations(path Path) {
+	keys := make(map[string]bool)
+	for _, doc := range []*Document{m.base, m.ours, m.theirs} {
+		for key := range doc.annotations {
+			if isBelowPath(key, path) {
+				keys[key] = true
+			}
+		}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	for _, key := range sorted {
+		p, err := ParsePath(key)
+		if err != nil {
+			continue
+		}
+		m.result.setAnnotation(p, m.mergeAnnotation(p))
+	}
+}
+
+// isBelowPath reports whether the path string key lies strictly below path.
+func isBelowPath(key string, path Path) bool {
+	prefix := path.String()
+	return strings.HasPrefix(key, prefix+".") || strings.HasPrefix(key, prefix+"[")
+}
+
+// copyAnnotations copies nested annotations at and below path from src
+// into the result.
+func (m *merger) copyAnnotations(src *Document, path Path) {
+	m.copyAnnotationsTo(src, path, path)
+}
+
+// copyAnnotationsTo copies nested annotations at and below from in src to
+// the same places below to in the result.
+func (m *merger) copyAnnotationsTo(src *Document, from, to Path) {
+	prefix, target := from.String(), to.String()
+	for key, typ := range src.annotations {
+		if key == prefix || isBelowPath(key, from) {
+			if m.result.annotations == nil {
+				m.result.annotations = make(map[string]string)
+			}
+			m.result.annotations[target+key[len(prefix):]] = typ
+		}
+	}
+}
+
+// mergeDirectives keeps our directives that theirs didn't remove and adds
+// directives that theirs introduced.
+func mergeDirectives(base, ours, theirs []Directive) []Directive {
+	contains := func(list []Directive, dir Directive) bool {
+		for _, d := range list {
+			if d.Name == dir.Name && Equal(d.Value, dir.Value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var result []Directive
+	for _, dir := range ours {
+		if contains(base, dir) && !contains(theirs, dir) {
+			continue
+		}
+		result = append(result, dir)
+	}
+	for _, dir := range theirs {
+		if !contains(base, dir) && !contains(result, dir) {
+			result = append(result, dir)
+		}
+	}
+	return result
+}
+
+// unionKeys returns the sorted union of the keys of the given blocks.
+func unionKeys(blocks ...Block) []string {
+	union := make(Block)
+	for _, b := range blocks {
+		for k := range b {
+			union[k] = nil
+		}
+	}
+	keys := make([]string, 0, len(union))
+	for _, c := range mapChildren(union) {
+		keys = append(keys, c.elem.Key)
+	}
+	return keys
+}
+
+// hasListPrefix reports whether list starts with prefix.
+func hasListPrefix(list, prefix List) bool {
+	return len(list) >= len(prefix) && Equal(list[:len(prefix)], prefix)
+}
@@ -0,0 +1,178 @@
+package up
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	base := `name api
+port!int 8080
+server {
+host localhost
+timeout 30s
+}
+hosts [
+a
+b
+]
+owner ops
+`
+	ours := `name api
+port!int 9090
+server {
+host localhost
+timeout 60s
+}
+hosts [
+a
+b
+c
+]
+owner dev
+`
+	theirs := `name api
+port!int 8080
+server {
+host 0.0.0.0
+timeout 30s
+}
+hosts [
+a
+b
+d
+]
+owner qa
+region eu
+`
+
+	p := NewParser()
+	parse := func(s string) *Document {
+		doc, err := p.ParseDocument(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("ParseDocument() failed: %v", err)
+		}
+		return doc
+	}
+
+	result := Merge3(parse(base), parse(ours), parse(theirs))
+
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Path.String() != "owner" {
+		t.Fatalf("expected a single conflict on owner, got %v", result.Conflicts)
+	}
+	if !strings.Contains(result.Conflicts[0].String(), `ours "dev", theirs "qa"`) {
+		t.Errorf("unexpected conflict rendering: %s", result.Conflicts[0])
+	}
+
+	expected := `name api
+port!int 9090
+server {
+  host 0.0.0.0
+  timeout 60s
+}
+hosts [
+  a
+  b
+  c
+  d
+]
+owner dev
+region eu
+`
+	text, err := Format(result.Document)
+	if err != nil {
+		t.Fatalf("Format() failed: %v", err)
+	}
+	if string(text) != expected {
+		t.Errorf("Merge3():\nexpected:\n%s\ngot:\n%s", expected, text)
+	}
+}
+
+func TestMerge3_Deletions(t *testing.T) {
+	base := NewBuilder().Set("a", "1").Set("b", "2").Block("c", func(b *BlockBuilder) { b.Set("x", "1") }).Document()
+	ours := NewBuilder().Set("b", "2").Block("c", func(b *BlockBuilder) { b.Set("x", "2") }).Document()
+	theirs := NewBuilder().Set("a", "1").Set("b", "3").Document()
+
+	result := Merge3(base, ours, theirs)
+
+	if nodeKeys(result.Document) != "b,c" {
+		t.Errorf("unexpected keys: %s", nodeKeys(result.Document))
+	}
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Path.String() != "c" || result.Conflicts[0].Theirs != nil {
+		t.Errorf("expected modify/delete conflict on c, got %v", result.Conflicts)
+	}
+	if v, _ := result.Document.Get("b"); v != "3" {
+		t.Errorf("expected b=3, got %v", v)
+	}
+}
+
+func TestMerge3_TypeConflict(t *testing.T) {
+	base := NewBuilder().SetTyped("port", "int", "80").Document()
+	ours := NewBuilder().SetTyped("port", "string", "80").Document()
+	theirs := NewBuilder().SetTyped("port", "float", "80").Document()
+
+	result := Merge3(base, ours, theirs)
+	if len(result.Conflicts) != 1 || !result.Conflicts[0].Type {
+		t.Fatalf("expected a type conflict, got %v", result.Conflicts)
+	}
+	if result.Document.Nodes[0].Type != "string" {
+		t.Errorf("expected our annotation to be kept, got %q", result.Document.Nodes[0].Type)
+	}
+}
+
+func TestMerge3_NestedAnnotations(t *testing.T) {
+	parse := func(s string) *Document {
+		doc, err := NewParser().ParseDocument(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("ParseDocument() failed: %v", err)
+		}
+		return doc
+	}
+	base := parse("server {\n  port!int 80\n  debug!bool true\n}\n")
+	ours := parse("server {\n  port!int 80\n  debug!bool true\n}\n")
+	theirs := parse("server {\n  port!string 80\n  debug!bool true\n}\n")
+
+	result := Merge3(base, ours, theirs)
+	if len(result.Conflicts) != 0 {
+		t.Fatalf("expected no conflicts, got %v", result.Conflicts)
+	}
+	if typ := result.Document.annotation(Path{{Key: "server"}, {Key: "port"}}); typ != "string" {
+		t.Errorf("expected their annotation string on server.port, got %q", typ)
+	}
+	if typ := result.Document.annotation(Path{{Key: "server"}, {Key: "debug"}}); typ != "bool" {
+		t.Errorf("expected annotation bool on server.debug, got %q", typ)
+	}
+
+	ours = parse("server {\n  port!float 80\n  debug!bool true\n}\n")
+	result = Merge3(base, ours, theirs)
+	if len(result.Conflicts) != 1 || !result.Conflicts[0].Type || result.Conflicts[0].Path.String() != "server.port" {
+		t.Errorf("expected a type conflict on server.port, got %v", result.Conflicts)
+	}
+}
+
+func TestMerge3_AppendedAnnotations(t *testing.T) {
+	parse := func(s string) *Document {
+		doc, err := NewParser().ParseDocument(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("ParseDocument() failed: %v", err)
+		}
+		return doc
+	}
+	base := parse("hosts [\n{\nport!int 1\n}\n]\n")
+	ours := parse("hosts [\n{\nport!int 1\n}\n{\nport!int 2\n}\n]\n")
+	theirs := parse("hosts [\n{\nport!int 1\n}\n{\nweight!float 3\n}\n]\n")
+
+	result := Merge3(base, ours, theirs)
+	if len(result.Conflicts) != 0 {
+		t.Fatalf("expected no conflicts, got %v", result.Conflicts)
+	}
+	for path, want := range map[string]string{
+		"hosts[0].port":   "int",
+		"hosts[1].port":   "int",
+		"hosts[2].weight": "float",
+	} {
+		if typ := result.Document.Annotation(path); typ != want {
+			t.Errorf("%s: expected annotation %q, got %q", path, want, typ)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package up
+
+import (
+	"fmt"
+)
+
+// Get returns the value at path (e.g., "server.port" or "servers[0].host").
+func (d *Document) Get(path string) (Value, bool) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return nil, false
+	}
+	return lookupPath(d, p)
+}
+
+// Annotation returns the type annotation recorded for path (e.g., "int" for
+// port!int), or "" if there is none. Top-level annotations come from
+// Node.Type; nested ones are recorded by the parser.
+func (d *Document) Annotation(path string) string {
+	p, err := ParsePath(path)
+	if err != nil {
+		return ""
+	}
+	return d.annotation(p)
+}
+
+// SetAnnotation records the type annotation for an existing path.
+func (d *Document) SetAnnotation(path, typ string) error {
+	p, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := lookupPath(d, p); !ok {
+		return fmt.Errorf("path %s: not found", p)
+	}
+	d.setAnnotation(p, typ)
+	return nil
+}
+
+// annotation returns the type annotation for a concrete path.
+func (d *Document) annotation(p Path) string {
+	if len(p) == 1 && !p[0].IsIndex {
+		if idx := d.nodeIndex(p[0].Key); idx != -1 {
+			return d.Nodes[idx].Type
+		}
+		return ""
+	}
+	return d.annotations[p.String()]
+}
+
+// setAnnotation records the type annotation for a concrete path.
+func (d *Document) setAnnotation(p Path, typ string) {
+	if len(p) == 1 && !p[0].IsIndex {
+		if idx := d.nodeIndex(p[0].Key); idx != -1 {
+			d.Nodes[idx].Type = typ
+		}
+		return
+	}
+	if d.annotations == nil {
+		d.annotations = make(map[string]string)
+	}
+	if typ == "" {
+		delete(d.annotations, p.String())
+	} else {
+		d.annotations[p.String()] = typ
+	}
+}
+
+// Set stores value at path, creating the top-level node and any
+// intermediate blocks that don't exist yet. Existing top-level nodes keep
+// their position and type annotation; new ones are appended.
+func (d *Document) Set(path string, value Value) error {
+	p, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+	old, _ := lookupPath(d, p)
+	if err := setPath(d, p, value, true); err != nil {
+		return err
+	}
+	d.pruneReplaced(p, old, value)
+	return nil
+}
+
+// Delete removes the value at path. Deleting a list element shifts the
+// elements after it.
+func (d *Document) Delete(path string) error {
+	p, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+
+	if len(p) == 1 {
+		idx := d.nodeIndex(p[0].Key)
+		if idx == -1 {
+			return fmt.Errorf("path %s: key %q not found", p, p[0].Key)
+		}
+		d.Nodes = append(d.Nodes[:idx], d.Nodes[idx+1:]...)
+		d.prunePaths(p)
+		return nil
+	}
+
+	parentPath, last := p[:len(p)-1], p[len(p)-1]
+	parent, ok := lookupPath(d, parentPath)
+	if !ok {
+		return fmt.Errorf("path %s: %s not found", p, parentPath)
+	}
+
+	if last.IsIndex {
+		updated, err := removeListItem(parent, last.Index)
+		if err != nil {
+			return fmt.Errorf("path %s: %w", p, err)
+		}
+		if err := setPath(d, parentPath, updated, false); err != nil {
+			return err
+		}
+		d.prunePaths(p)
+		d.shiftPaths(parentPath, last.Index+1, -1)
+		return nil
+	}
+
+	switch m := parent.(type) {
+	case Block:
+		if _, ok := m[last.Key]; !ok {
+			return fmt.Errorf("path %s: key %q not found", p, last.Key)
+		}
+		delete(m, last.Key)
+	case map[string]any:
+		if _, ok := m[last.Key]; !ok {
+			return fmt.Errorf("path %s: key %q not found", p, last.Key)
+		}
+		delete(m, last.Key)
+	default:
+		return fmt.Errorf("path %s: %s is not a block", p, parentPath)
+	}
+	d.prunePaths(p)
+	return nil
+}
+
+// InsertBefore inserts node before the element at path. The path must name
+// either a top-level node or a list element; for list elements only
+// node.Value is used. If a top-level node with the same key already exists
+// it is moved, which allows reordering.
+func (d *Document) InsertBefore(path string, node Node) error {
+	return d.insert(path, node, 0)
+}
+
+// InsertAfter inserts node after the element at path. See InsertBefore.
+func (d *Document) InsertAfter(path string, node Node) error {
+	return d.insert(path, node, 1)
+}
+
+// insert implements InsertBefore and InsertAfter.
+func (d *Document) insert(path string, node Node, offset int) error {
+	p, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+
+	if len(p) == 1 {
+		// Validate the target before moving anything so a failed insert
+		// leaves the document unchanged.
+		if node.Key == p[0].Key {
+			return fmt.Errorf("path %s: cannot insert a node relative to itself", p)
+		}
+		if d.nodeIndex(p[0].Key) == -1 {
+			return fmt.Errorf("path %s: key %q not found", p, p[0].Key)
+		}
+		if existing := d.nodeIndex(node.Key); existing != -1 {
+			d.pruneReplaced(Path{{Key: node.Key}}, d.Nodes[existing].Value, node.Value)
+			d.Nodes = append(d.Nodes[:existing], d.Nodes[existing+1:]...)
+		}
+		idx := d.nodeIndex(p[0].Key) + offset
+		d.Nodes = append(d.Nodes[:idx], append([]Node{node}, d.Nodes[idx:]...)...)
+		return nil
+	}
+
+	last := p[len(p)-1]
+	if !last.IsIndex {
+		return fmt.Errorf("path %s: keys inside a block are unordered", p)
+	}
+
+	parentPath := p[:len(p)-1]
+	parent, ok := lookupPath(d, parentPath)
+	if !ok {
+		return fmt.Errorf("path %s: %s not found", p, parentPath)
+	}
+	updated, err := insertListItem(parent, last.Index, offset, node.Value)
+	if err != nil {
+		return fmt.Errorf("path %s: %w", p, err)
+	}
+	if err := setPath(d, parentPath, updated, false); err != nil {
+		return err
+	}
+	d.shiftPaths(parentPath, last.Index+offset, 1)
+	return nil
+}
+
+// prunePaths forgets the annotations, positions and multi-line forms
+// recorded at and below p once its value has been deleted.
+func (d *Document) prunePaths(p Path) {
+	prefix := p.String()
+	d.forget(func(key string) bool { return key == prefix || isBelowPath(key, p) })
+}
+
+// pruneReplaced forgets what was recorded for the old value at p once it
+// has been replaced by a different value: everything below p and the
+// multi-line form of p itself. The annotation and position of p are kept.
+func (d *Document) pruneReplaced(p Path, old, value Value) {
+	if Equal(old, value) {
+		return
+	}
+	d.forget(func(key string) bool { return isBelowPath(key, p) })
+	delete(d.multiline, p.String())
+}
+
+// forget deletes the annotations, positions and multi-line forms whose
+// path matches.
+func (d *Document) forget(match func(key string) bool) {
+	for key := range d.annotations {
+		if match(key) {
+			delete(d.annotations, key)
+		}
+	}
+	for key := range d.positions {
+		if match(key) {
+			delete(d.positions, key)
+		}
+	}
+	for key := range d.multiline {
+		if match(key) {
+			delete(d.multiline, key)
+		}
+	}
+}
+
+// shiftPaths moves the annotations, positions and multi-line forms recorded
+// for the elements of the list at p, from index start on, by delta places
+// so they follow their elements after an insert or delete.
+func (d *Document) shiftPaths(p Path, start, delta int) {
+	d.annotations = shiftKeys(d.annotations, p, start, delta)
+	d.positions = shiftKeys(d.positions, p, start, delta)
+	d.multiline = shiftKeys(d.multiline, p, start, delta)
+}
+
+// shiftKeys returns m with the index following list in each key shifted by
+// delta, if it is at least start.
+func shiftKeys[V any](m map[string]V, list Path, start, delta int) map[string]V {
+	if len(m) == 0 {
+		return m
+	}
+	shifted := make(map[string]V, len(m))
+	for key, v := range m {
+		if isBelowPath(key, list) {
+			if p, err := ParsePath(key); err == nil && p[len(list)].IsIndex && p[len(list)].Index >= start {
+				p[len(list)].Index += delta
+				key = p.String()
+			}
+		}
+		shifted[key] = v
+	}
+	return shifted
+}
+
+// Append adds item to the end of the list at path. If nothing exists at
+// path, a new list is created along with any intermediate blocks.
+func (d *Document) Append(path string, item Value) error {
+	p, err := ParsePath(path)
+	if err != nil {
+		return err
+	}
+
+	existing, ok := lookupPath(d, p)
+	if !ok {
+		return setPath(d, p, List{item}, true)
+	}
+
+	switch l := existing.(type) {
+	case List:
+		return setPath(d, p, append(l, item), false)
+	case []any:
+		return setPath(d, p, append(l, item), false)
+	default:
+		return fmt.Errorf("path %s: cannot append to %T", p, existing)
+	}
+}
+
+// Clone returns a deep copy of the document.
+func (d *Document) Clone() *Document {
+	result := &Document{Nodes: make([]Node, len(d.Nodes))}
+	for i, node := range d.Nodes {
+		result.Nodes[i] = Node{Key: node.Key, Type: node.Type, Value: cloneValue(node.Value)}
+	}
+	if d.Directives != nil {
+		result.Directives = make([]Directive, len(d.Directives))
+		for i, dir := range d.Directives {
+			result.Directives[i] = Directive{Name: dir.Name, Value: cloneValue(dir.Value)}
+		}
+	}
+	if d.annotations != nil {
+		result.annotations = make(map[string]string, len(d.annotations))
+		for k, v := range d.annotations {
+			result.annotations[k] = v
+		}
+	}
+	if d.positions != nil {
+		result.positions = make(map[string]Position, len(d.positions))
+		for k, v := range d.positions {
+			result.positions[k] = v
+		}
+	}
+	if d.multiline != nil {
+		result.multiline = make(map[string]bool, len(d.multiline))
+		for k, v := range d.multiline {
+			result.multiline[k] = v
+		}
+	}
+	return result
+}
+
+// nodeIndex returns the index of the first top-level node with key, or -1.
+func (d *Document) nodeIndex(key string) int {
+	for i, node := range d.Nodes {
+		if node.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// cloneValue returns a deep copy of a value.
+func cloneValue(v Value) Value {
+	switch v := v.(type) {
+	case Block:
+		result := make(Block, len(v))
+		for k, val := range v {
+			result[k] = cloneValue(val)
+		}
+		return result
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for k, val := range v {
+			result[k] = cloneValue(val)
+		}
+		return result
+	case List:
+		result := make(List, len(v))
+		for i, val := range v {
+			result[i] = cloneValue(val)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, val := range v {
+			result[i] = cloneValue(val)
+		}
+		return result
+	case UseDirective:
+		return UseDirective{Namespaces: append([]string(nil), v.Namespaces...)}
+	default:
+		return v
+	}
+}
+
+// removeListItem returns list with the element at index removed.
+func removeListItem(list Value, index int) (Value, error) {
+	switch l := list.(type) {
+	case List:
+		if index < 0 || index >= len(l) {
+			return nil, fmt.Errorf("index %d out of range", index)
+		}
+		return append(l[:index:index], l[index+1:]...), nil
+	case []any:
+		if index < 0 || index >= len(l) {
+			return nil, fmt.Errorf("index %d out of range", index)
+		}
+		return append(l[:index:index], l[index+1:]...), nil
+	default:
+		return nil, fmt.Errorf("%T is not a list", list)
+	}
+}
+
+// insertListItem returns list with item inserted at index+offset.
+func insertListItem(list Value, index, offset int, item Value) (Value, error) {
+	switch l := list.(type) {
+	case List:
+		if index < 0 || index >= len(l) {
+			return nil, fmt.Errorf("index %d out of range", index)
+		}
+		at := index + offset
+		return append(l[:at:at], append(List{item}, l[at:]...)...), nil
+	case []any:
+		if index < 0 || index >= len(l) {
+			return nil, fmt.Errorf("index %d out of range", index)
+		}
+		at := index + offset
+		return append(l[:at:at], append([]any{item}, l[at:]...)...), nil
+	default:
+		return nil, fmt.Errorf("%T is not a list", list)
+	}
+}
@@ -0,0 +1,214 @@
+package up
+
+import (
+	"strings"
+	"testing"
+)
+
+func nodeKeys(doc *Document) string {
+	keys := make([]string, len(doc.Nodes))
+	for i, node := range doc.Nodes {
+		keys[i] = node.Key
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestDocumentSet(t *testing.T) {
+	doc := NewBuilder().
+		Set("name", "api").
+		SetTyped("port", "int", "8080").
+		Document()
+
+	if err := doc.Set("port", "9090"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if err := doc.Set("database.primary.host", "db1"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+
+	if nodeKeys(doc) != "name,port,database" {
+		t.Errorf("unexpected order: %s", nodeKeys(doc))
+	}
+	if doc.Nodes[1].Type != "int" || doc.Nodes[1].Value != "9090" {
+		t.Errorf("unexpected port node: %+v", doc.Nodes[1])
+	}
+	if v, _ := doc.Get("database.primary.host"); v != "db1" {
+		t.Errorf("expected db1, got %v", v)
+	}
+
+	if err := doc.Set("name.first", "x"); err == nil {
+		t.Error("expected error setting a key below a scalar")
+	}
+}
+
+func TestDocumentDeleteAndAppend(t *testing.T) {
+	doc := NewBuilder().
+		List("hosts", "a", "b", "c").
+		Block("server", func(b *BlockBuilder) { b.Set("host", "localhost").Set("port", "80") }).
+		Document()
+
+	if err := doc.Delete("hosts[1]"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if err := doc.Append("hosts", "d"); err != nil {
+		t.Fatalf("Append() failed: %v", err)
+	}
+	if err := doc.Append("server.aliases", "web"); err != nil {
+		t.Fatalf("Append() failed: %v", err)
+	}
+	if err := doc.Delete("server.port"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+
+	hosts, _ := doc.Get("hosts")
+	if got := hosts.(List); len(got) != 3 || got[0] != "a" || got[1] != "c" || got[2] != "d" {
+		t.Errorf("unexpected hosts: %v", got)
+	}
+	if _, ok := doc.Get("server.port"); ok {
+		t.Error("server.port should be deleted")
+	}
+	if v, _ := doc.Get("server.aliases[0]"); v != "web" {
+		t.Errorf("expected web, got %v", v)
+	}
+
+	if err := doc.Delete("hosts"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if nodeKeys(doc) != "server" {
+		t.Errorf("unexpected keys: %s", nodeKeys(doc))
+	}
+	if err := doc.Delete("missing"); err == nil {
+		t.Error("expected error deleting missing key")
+	}
+}
+
+func TestDocumentInsert(t *testing.T) {
+	doc := NewBuilder().Set("a", "1").Set("b", "2").Set("c", "3").List("l", "x", "z").Document()
+
+	if err := doc.InsertBefore("a", Node{Key: "first", Value: "0"}); err != nil {
+		t.Fatalf("InsertBefore() failed: %v", err)
+	}
+	if err := doc.InsertAfter("a", Node{Key: "c"}); err != nil {
+		t.Fatalf("InsertAfter() failed: %v", err)
+	}
+	if nodeKeys(doc) != "first,a,c,b,l" {
+		t.Errorf("unexpected order: %s", nodeKeys(doc))
+	}
+
+	if err := doc.InsertAfter("l[0]", Node{Value: "y"}); err != nil {
+		t.Fatalf("InsertAfter() failed: %v", err)
+	}
+	if l, _ := doc.Get("l"); len(l.(List)) != 3 || l.(List)[1] != "y" {
+		t.Errorf("unexpected list: %v", l)
+	}
+
+	if err := doc.InsertBefore("missing", Node{Key: "x"}); err == nil {
+		t.Error("expected error inserting before missing key")
+	}
+
+	// A failed insert must not move or drop an existing node
+	if err := doc.InsertBefore("missing", Node{Key: "a", Value: "moved"}); err == nil {
+		t.Error("expected error inserting before missing key")
+	}
+	if err := doc.InsertAfter("a", Node{Key: "a"}); err == nil {
+		t.Error("expected error inserting a node relative to itself")
+	}
+	if nodeKeys(doc) != "first,a,c,b,l" {
+		t.Errorf("failed insert changed the order: %s", nodeKeys(doc))
+	}
+	if v, _ := doc.Get("a"); v != "1" {
+		t.Errorf("failed insert changed a: %v", v)
+	}
+}
+
+func TestDocumentMutationsKeepAnnotations(t *testing.T) {
+	input := `ports [
+  {
+    n!int 1
+  }
+  {
+    n!int 2
+  }
+  {
+    n!float 3
+  }
+]
+server {
+  port!int 80
+}
+`
+	doc, err := NewParser().ParseDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	// Annotations and positions follow the elements they belong to
+	if err := doc.Delete("ports[0]"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if typ := doc.Annotation("ports[1].n"); typ != "float" {
+		t.Errorf("expected float on ports[1].n after delete, got %q", typ)
+	}
+	if typ := doc.Annotation("ports[2].n"); typ != "" {
+		t.Errorf("expected no annotation on ports[2].n after delete, got %q", typ)
+	}
+	if pos := doc.Position("ports[1].n"); pos.Line != 9 {
+		t.Errorf("expected ports[1].n on line 9, got %s", pos)
+	}
+
+	if err := doc.InsertBefore("ports[0]", Node{Value: Block{"n": "0"}}); err != nil {
+		t.Fatalf("InsertBefore() failed: %v", err)
+	}
+	if typ := doc.Annotation("ports[0].n"); typ != "" {
+		t.Errorf("expected no annotation on the inserted ports[0].n, got %q", typ)
+	}
+	if typ := doc.Annotation("ports[2].n"); typ != "float" {
+		t.Errorf("expected float on ports[2].n after insert, got %q", typ)
+	}
+
+	// Replacing a value forgets what was recorded below the old one, unless
+	// the value is unchanged
+	if err := doc.Set("ports[2]", Block{"n": "4"}); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if typ := doc.Annotation("ports[2].n"); typ != "" {
+		t.Errorf("expected no annotation on ports[2].n after Set, got %q", typ)
+	}
+	if err := doc.Set("ports[1]", Block{"n": "2"}); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if typ := doc.Annotation("ports[1].n"); typ != "int" {
+		t.Errorf("expected int on the unchanged ports[1].n, got %q", typ)
+	}
+	if err := doc.InsertBefore("ports", Node{Key: "server", Value: Block{"port": "8080"}}); err != nil {
+		t.Fatalf("InsertBefore() failed: %v", err)
+	}
+	if typ := doc.Annotation("server.port"); typ != "" {
+		t.Errorf("expected no annotation on the replaced server.port, got %q", typ)
+	}
+
+	// Deleted subtrees leave nothing behind for a later value at the same path
+	if err := doc.Delete("server"); err != nil {
+		t.Fatalf("Delete() failed: %v", err)
+	}
+	if err := doc.Set("server.port", "80"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if typ := doc.Annotation("server.port"); typ != "" {
+		t.Errorf("expected no annotation on the new server.port, got %q", typ)
+	}
+	if pos := doc.Position("server.port"); pos.IsValid() {
+		t.Errorf("expected no position for the new server.port, got %s", pos)
+	}
+}
+
+func TestDocumentClone(t *testing.T) {
+	doc := NewBuilder().Block("server", func(b *BlockBuilder) { b.Set("host", "a") }).Document()
+	clone := doc.Clone()
+	if err := clone.Set("server.host", "b"); err != nil {
+		t.Fatalf("Set() failed: %v", err)
+	}
+	if v, _ := doc.Get("server.host"); v != "a" {
+		t.Errorf("original modified: %v", v)
+	}
+}
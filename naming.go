@@ -0,0 +1,91 @@
+package up
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NamingStrategy determines the UP key of struct fields without an
+// explicit name in their `up` tag.
+type NamingStrategy int
+
+const (
+	NamingLower           NamingStrategy = iota // MaxConns → maxconns (the default)
+	NamingSnake                                 // MaxConns → max_conns
+	NamingKebab                                 // MaxConns → max-conns
+	NamingCamel                                 // MaxConns → maxConns
+	NamingExact                                 // MaxConns → MaxConns
+	NamingCaseInsensitive                       // Matches MaxConns, maxconns, MAXCONNS, ...; writes maxconns
+)
+
+// key returns the key written for a field with the given Go name.
+func (n NamingStrategy) key(name string) string {
+	switch n {
+	case NamingSnake:
+		return strings.ToLower(strings.Join(splitWords(name), "_"))
+	case NamingKebab:
+		return strings.ToLower(strings.Join(splitWords(name), "-"))
+	case NamingCamel:
+		words := splitWords(name)
+		for i, w := range words {
+			w = strings.ToLower(w)
+			if i > 0 {
+				w = strings.ToUpper(w[:1]) + w[1:]
+			}
+			words[i] = w
+		}
+		return strings.Join(words, "")
+	case NamingExact:
+		return name
+	default:
+		return strings.ToLower(name)
+	}
+}
+
+// match returns the key of data that a field with the given Go name reads
+// from. Only NamingCaseInsensitive looks at the keys present; if several
+// match, the first in sorted order wins.
+func (n NamingStrategy) match(data map[string]any, name string) string {
+	if n != NamingCaseInsensitive {
+		return n.key(name)
+	}
+	if _, ok := data[name]; ok {
+		return name
+	}
+	for _, c := range mapChildren(data) {
+		if strings.EqualFold(c.elem.Key, name) {
+			return c.elem.Key
+		}
+	}
+	return n.key(name)
+}
+
+// splitWords splits a Go identifier into words, keeping acronyms together:
+// "HTTPServerID" becomes ["HTTP", "Server", "ID"]. Digits stay with the
+// preceding word and underscores only separate words.
+func splitWords(name string) []string {
+	runes := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		boundary := unicode.IsUpper(cur) &&
+			(unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1])))
+		if cur == '_' {
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+			continue
+		}
+		if boundary && i > start {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
@@ -0,0 +1,210 @@
+package up
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// NativeOptions configures conversion between documents and native Go values.
+type NativeOptions struct {
+	// Typed converts annotated scalars to Go types in ToNative (!int to
+	// int64, !float to float64, !bool to bool) and annotates non-string
+	// scalars in FromNative.
+	Typed bool
+
+	// KeyOrder orders map keys when FromNative builds top-level nodes.
+	// Defaults to lexical order so the result is deterministic.
+	KeyOrder func(a, b string) bool
+}
+
+// ToNative converts a document into plain Go values: blocks and tables
+// become map[string]any, lists (inline or multi-line) become []any, and
+// scalars stay strings unless opts.Typed is set. Document directives are
+// not included. Later duplicate top-level keys win.
+func ToNative(doc *Document, opts NativeOptions) (map[string]any, error) {
+	result := make(map[string]any, len(doc.Nodes))
+	for _, node := range doc.Nodes {
+		path := Path{{Key: node.Key}}
+		v, err := toNative(doc, path, node.Type, node.Value, opts)
+		if err != nil {
+			return nil, err
+		}
+		result[node.Key] = v
+	}
+	return result, nil
+}
+
+// toNative converts a single value located at path.
+func toNative(doc *Document, path Path, typ string, value Value, opts NativeOptions) (any, error) {
+	switch v := value.(type) {
+	case string:
+		if !opts.Typed {
+			return v, nil
+		}
+		converted, err := convertScalar(typ, v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return converted, nil
+	case Block:
+		return mapToNative(doc, path, v, opts)
+	case map[string]any:
+		return mapToNative(doc, path, v, opts)
+	case List:
+		return listToNative(doc, path, v, opts)
+	case []any:
+		return listToNative(doc, path, v, opts)
+	default:
+		return v, nil
+	}
+}
+
+func mapToNative[M ~map[string]V, V any](doc *Document, path Path, m M, opts NativeOptions) (map[string]any, error) {
+	result := make(map[string]any, len(m))
+	for k, val := range m {
+		p := path.Key(k)
+		v, err := toNative(doc, p, doc.annotation(p), val, opts)
+		if err != nil {
+			return nil, err
+		}
+		result[k] = v
+	}
+	return result, nil
+}
+
+func listToNative[L ~[]V, V any](doc *Document, path Path, l L, opts NativeOptions) ([]any, error) {
+	result := make([]any, len(l))
+	for i, val := range l {
+		p := path.Index(i)
+		v, err := toNative(doc, p, doc.annotation(p), val, opts)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+// convertScalar converts a scalar string according to its type annotation.
+// Unknown annotations leave the value as a string.
+func convertScalar(typ, s string) (any, error) {
+	switch typ {
+	case "int", "integer":
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as int", s)
+		}
+		return i, nil
+	case "float", "number":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q as float", s)
+		}
+		return f, nil
+	case "bool", "boolean":
+		b, err := parseBool(s)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	default:
+		return s, nil
+	}
+}
+
+// FromNative builds a document from plain Go values. Maps with string keys
+// become blocks, slices and arrays become lists and scalars are formatted
+// as strings. Top-level nodes are ordered by opts.KeyOrder.
+func FromNative(m map[string]any, opts NativeOptions) (*Document, error) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	less := opts.KeyOrder
+	if less == nil {
+		less = func(a, b string) bool { return a < b }
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+
+	doc := &Document{Nodes: make([]Node, 0, len(keys))}
+	for _, k := range keys {
+		path := Path{{Key: k}}
+		v, typ, err := fromNative(doc, path, reflect.ValueOf(m[k]), opts)
+		if err != nil {
+			return nil, err
+		}
+		doc.Nodes = append(doc.Nodes, Node{Key: k, Type: typ, Value: v})
+	}
+	return doc, nil
+}
+
+// fromNative converts a native value located at path and returns the UP
+// value along with the type annotation to record for it.
+func fromNative(doc *Document, path Path, rv reflect.Value, opts NativeOptions) (Value, string, error) {
+	for rv.Kind() == reflect.Interface || rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "", "", nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return "", "", nil
+	}
+
+	annotate := func(typ string) string {
+		if opts.Typed {
+			return typ
+		}
+		return ""
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), "", nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), annotate("bool"), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), annotate("int"), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(rv.Uint(), 10), annotate("int"), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, rv.Type().Bits()), annotate("float"), nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, "", fmt.Errorf("%s: map keys must be strings, got %s", path, rv.Type().Key())
+		}
+		block := make(Block, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			p := path.Key(key)
+			v, typ, err := fromNative(doc, p, iter.Value(), opts)
+			if err != nil {
+				return nil, "", err
+			}
+			block[key] = v
+			if typ != "" {
+				doc.setAnnotation(p, typ)
+			}
+		}
+		return block, "", nil
+	case reflect.Slice, reflect.Array:
+		list := make(List, rv.Len())
+		for i := range list {
+			p := path.Index(i)
+			v, typ, err := fromNative(doc, p, rv.Index(i), opts)
+			if err != nil {
+				return nil, "", err
+			}
+			list[i] = v
+			if typ != "" {
+				doc.setAnnotation(p, typ)
+			}
+		}
+		return list, "", nil
+	default:
+		return nil, "", fmt.Errorf("%s: unsupported type %s", path, rv.Type())
+	}
+}
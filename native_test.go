@@ -0,0 +1,105 @@
+package up
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestToNative(t *testing.T) {
+	input := `!use [time]
+name demo
+port!int 8080
+server {
+debug!bool true
+ratio!float 0.5
+}
+tags [a, b]
+hosts [
+web
+{
+name db
+}
+]
+`
+
+	doc, err := NewParser().ParseDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	untyped, err := ToNative(doc, NativeOptions{})
+	if err != nil {
+		t.Fatalf("ToNative() failed: %v", err)
+	}
+	expectedUntyped := map[string]any{
+		"name":   "demo",
+		"port":   "8080",
+		"server": map[string]any{"debug": "true", "ratio": "0.5"},
+		"tags":   []any{"a", "b"},
+		"hosts":  []any{"web", map[string]any{"name": "db"}},
+	}
+	if !reflect.DeepEqual(untyped, expectedUntyped) {
+		t.Errorf("ToNative() untyped:\nexpected: %#v\ngot:      %#v", expectedUntyped, untyped)
+	}
+
+	typed, err := ToNative(doc, NativeOptions{Typed: true})
+	if err != nil {
+		t.Fatalf("ToNative() failed: %v", err)
+	}
+	if typed["port"] != int64(8080) {
+		t.Errorf("expected int64 port, got %#v", typed["port"])
+	}
+	server := typed["server"].(map[string]any)
+	if server["debug"] != true || server["ratio"] != 0.5 {
+		t.Errorf("unexpected typed server: %#v", server)
+	}
+
+	doc.Nodes[1].Value = "not-a-number"
+	if _, err := ToNative(doc, NativeOptions{Typed: true}); err == nil || !strings.Contains(err.Error(), "port") {
+		t.Errorf("expected error naming port, got %v", err)
+	}
+}
+
+func TestFromNative(t *testing.T) {
+	native := map[string]any{
+		"name": "demo",
+		"port": 8080,
+		"server": map[string]any{
+			"debug": true,
+			"ratio": 0.5,
+		},
+		"tags": []string{"a", "b"},
+	}
+
+	doc, err := FromNative(native, NativeOptions{Typed: true})
+	if err != nil {
+		t.Fatalf("FromNative() failed: %v", err)
+	}
+
+	if nodeKeys(doc) != "name,port,server,tags" {
+		t.Errorf("unexpected node order: %s", nodeKeys(doc))
+	}
+	if doc.Annotation("port") != "int" || doc.Annotation("server.debug") != "bool" {
+		t.Errorf("missing annotations: port=%q server.debug=%q",
+			doc.Annotation("port"), doc.Annotation("server.debug"))
+	}
+
+	roundTrip, err := ToNative(doc, NativeOptions{Typed: true})
+	if err != nil {
+		t.Fatalf("ToNative() failed: %v", err)
+	}
+	expected := map[string]any{
+		"name":   "demo",
+		"port":   int64(8080),
+		"server": map[string]any{"debug": true, "ratio": 0.5},
+		"tags":   []any{"a", "b"},
+	}
+	if !reflect.DeepEqual(roundTrip, expected) {
+		t.Errorf("round trip:\nexpected: %#v\ngot:      %#v", expected, roundTrip)
+	}
+
+	if _, err := FromNative(map[string]any{"bad": map[int]string{1: "x"}}, NativeOptions{}); err == nil {
+		t.Error("expected error for non-string map keys")
+	}
+}
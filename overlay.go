@@ -0,0 +1,237 @@
+package up
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OverlayOptions configures ComputeOverlay.
+type OverlayOptions struct {
+	// MergeStrategy and ListStrategy describe how the overlay will be
+	// applied; they default to the template engine's "deep" and "append".
+	// Non-default strategies are recorded in a !merge node.
+	MergeStrategy string
+	ListStrategy  string
+
+	// BaseFile, if set, is emitted as a !base directive so the overlay can
+	// be processed directly with TemplateEngine.ProcessTemplate.
+	BaseFile string
+}
+
+// ComputeOverlay returns the minimal overlay document that transforms base
+// into desired when processed by the template engine: changed and new
+// top-level keys become regular nodes holding only what differs, and lists
+// that can't be reached by merging are replaced through a !patch block.
+//
+// Nested type annotations of desired are carried into the overlay, and a
+// changed annotation is a change even when the value is the same. The
+// engine cannot remove keys, so ComputeOverlay returns an error naming
+// every key that exists in base but not in desired.
+func ComputeOverlay(base, desired *Document, opts OverlayOptions) (*Document, error) {
+	if opts.MergeStrategy == "" {
+		opts.MergeStrategy = "deep"
+	}
+	if opts.ListStrategy == "" {
+		opts.ListStrategy = "append"
+	}
+
+	c := &overlayComputer{
+		engine: NewTemplateEngine().WithOptions(TemplateOptions{
+			MergeStrategy: opts.MergeStrategy,
+			ListStrategy:  opts.ListStrategy,
+		}),
+		base:    base,
+		desired: desired,
+		patches: make(Block),
+	}
+
+	overlay := &Document{Nodes: []Node{}}
+	if opts.BaseFile != "" {
+		overlay.Nodes = append(overlay.Nodes, Node{Key: "base", Type: "base", Value: opts.BaseFile})
+	}
+	if opts.MergeStrategy != "deep" || opts.ListStrategy != "append" {
+		overlay.Nodes = append(overlay.Nodes, Node{Key: "merge", Type: "merge", Value: Block{
+			"strategy":      opts.MergeStrategy,
+			"list_strategy": opts.ListStrategy,
+		}})
+	}
+
+	for _, node := range desired.Nodes {
+		path := Path{{Key: node.Key}}
+		idx := base.nodeIndex(node.Key)
+		if idx == -1 {
+			overlay.Nodes = append(overlay.Nodes, node)
+			c.emit(path, path)
+			continue
+		}
+
+		baseNode := base.Nodes[idx]
+		value, changed := c.overlayValue(path, baseNode.Value, node.Value)
+		if !changed && baseNode.Type != node.Type {
+			// Only the annotation changed: emit a value that merges to
+			// the same content so the new type is picked up.
+			value, changed = c.identityValue(path, baseNode.Value, node.Value), true
+		}
+		if changed {
+			overlay.Nodes = append(overlay.Nodes, Node{Key: node.Key, Type: node.Type, Value: value})
+		}
+	}
+
+	for _, node := range base.Nodes {
+		if desired.nodeIndex(node.Key) == -1 {
+			c.removed = append(c.removed, Path{{Key: node.Key}}.String())
+		}
+	}
+	if len(c.removed) > 0 {
+		return nil, fmt.Errorf("overlay cannot remove keys: %s", strings.Join(c.removed, ", "))
+	}
+
+	if len(c.patches) > 0 {
+		overlay.Nodes = append(overlay.Nodes, Node{Key: "patches", Type: "patch", Value: c.patches})
+	}
+	c.copyAnnotations(overlay)
+	return overlay, nil
+}
+
+// overlayComputer holds state while computing an overlay.
+type overlayComputer struct {
+	engine        *TemplateEngine
+	base, desired *Document
+	patches       Block         // replacements applied after merging, keyed by path
+	removed       []string      // paths present in base but not in desired
+	emitted       []emittedPath // desired values written into the overlay
+}
+
+// emittedPath pairs a location in the overlay with the location in desired
+// whose value was written there.
+type emittedPath struct {
+	overlay, desired Path
+}
+
+// emit records that the desired value at desired was written to overlay.
+func (c *overlayComputer) emit(overlay, desired Path) {
+	c.emitted = append(c.emitted, emittedPath{overlay: overlay, desired: desired})
+}
+
+// patch replaces the value at path through the !patch block.
+func (c *overlayComputer) patch(path Path, desired Value) {
+	c.patches[path.String()] = desired
+	c.emit(Path{{Key: "patches"}, {Key: path.String()}}, path)
+}
+
+// copyAnnotations copies the annotations of every emitted desired value,
+// and of everything below it, to where the value sits in the overlay.
+func (c *overlayComputer) copyAnnotations(overlay *Document) {
+	for _, e := range c.emitted {
+		if typ := c.desired.annotation(e.desired); typ != "" {
+			overlay.setAnnotation(e.overlay, typ)
+		}
+		prefix, target := e.desired.String(), e.overlay.String()
+		for key, typ := range c.desired.annotations {
+			if isBelowPath(key, e.desired) {
+				if overlay.annotations == nil {
+					overlay.annotations = make(map[string]string)
+				}
+				overlay.annotations[target+key[len(prefix):]] = typ
+			}
+		}
+	}
+}
+
+// annotationsDiffer reports whether the nested annotations at or below
+// path differ between base and desired.
+func (c *overlayComputer) annotationsDiffer(path Path) bool {
+	prefix := path.String()
+	for _, pair := range [][2]*Document{{c.base, c.desired}, {c.desired, c.base}} {
+		for key, typ := range pair[0].annotations {
+			if (key == prefix || isBelowPath(key, path)) && pair[1].annotations[key] != typ {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// overlayValue returns the value that, merged onto base, yields desired.
+// It reports false when no overlay is needed for path.
+func (c *overlayComputer) overlayValue(path Path, base, desired Value) (Value, bool) {
+	if Equal(base, desired) && !c.annotationsDiffer(path) {
+		return nil, false
+	}
+
+	baseBlock, baseIsBlock := base.(Block)
+	desiredBlock, desiredIsBlock := desired.(Block)
+	if baseIsBlock && desiredIsBlock && c.engine.options.MergeStrategy == "deep" {
+		result := make(Block)
+		for _, entry := range mapChildren(desiredBlock) {
+			p := path.Key(entry.elem.Key)
+			existing, ok := baseBlock[entry.elem.Key]
+			if !ok {
+				result[entry.elem.Key] = entry.value
+				c.emit(p, p)
+				continue
+			}
+			if v, changed := c.overlayValue(p, existing, entry.value); changed {
+				result[entry.elem.Key] = v
+			}
+		}
+		for key := range baseBlock {
+			if _, ok := desiredBlock[key]; !ok {
+				c.removed = append(c.removed, path.Key(key).String())
+			}
+		}
+		if len(result) == 0 {
+			// Everything below was handled by patches.
+			return nil, false
+		}
+		return result, true
+	}
+
+	for _, candidate := range c.candidates(base, desired) {
+		if c.mergesTo(base, candidate, desired) {
+			if tail, ok := candidate.(List); ok && !Equal(candidate, desired) {
+				// Appended items sit at the end of the desired list
+				offset := len(desired.(List)) - len(tail)
+				for i := range tail {
+					c.emit(path.Index(i), path.Index(offset+i))
+				}
+			} else {
+				c.emit(path, path)
+			}
+			return candidate, true
+		}
+	}
+
+	c.patch(path, desired)
+	return nil, false
+}
+
+// identityValue returns a value that merges onto base without changing it.
+func (c *overlayComputer) identityValue(path Path, base, desired Value) Value {
+	for _, candidate := range []Value{Block{}, List{}, desired} {
+		if c.mergesTo(base, candidate, desired) {
+			if Equal(candidate, desired) {
+				c.emit(path, path)
+			}
+			return candidate
+		}
+	}
+	c.patch(path, desired)
+	return desired
+}
+
+// candidates returns possible overlay values for base, most minimal first.
+func (c *overlayComputer) candidates(base, desired Value) []Value {
+	baseList, baseIsList := base.(List)
+	desiredList, desiredIsList := desired.(List)
+	if baseIsList && desiredIsList && len(desiredList) > len(baseList) &&
+		Equal(baseList, desiredList[:len(baseList)]) {
+		return []Value{desiredList[len(baseList):], desired}
+	}
+	return []Value{desired}
+}
+
+// mergesTo reports whether merging overlay onto base yields desired.
+func (c *overlayComputer) mergesTo(base, overlay, desired Value) bool {
+	return Equal(c.engine.mergeValues(cloneValue(base), cloneValue(overlay)), desired)
+}
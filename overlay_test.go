@@ -0,0 +1,193 @@
+package up
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestComputeOverlay(t *testing.T) {
+	base := `name api
+port!int 8080
+server {
+host localhost
+timeout 30s
+tls {
+enabled false
+}
+}
+hosts [
+a
+b
+]
+regions [
+eu
+us
+]
+`
+	desired := `name api
+port!string 8080
+server {
+host 0.0.0.0
+timeout 30s
+tls {
+enabled true
+}
+}
+hosts [
+a
+b
+c
+]
+regions [
+us
+]
+replicas 3
+`
+
+	p := NewParser()
+	baseDoc, err := p.ParseDocument(strings.NewReader(base))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+	desiredDoc, err := p.ParseDocument(strings.NewReader(desired))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	overlay, err := ComputeOverlay(baseDoc, desiredDoc, OverlayOptions{BaseFile: "base.up"})
+	if err != nil {
+		t.Fatalf("ComputeOverlay() failed: %v", err)
+	}
+
+	text, err := Format(overlay)
+	if err != nil {
+		t.Fatalf("Format() failed: %v", err)
+	}
+
+	expected := `base!base base.up
+port!string 8080
+server {
+  host 0.0.0.0
+  tls {
+    enabled true
+  }
+}
+hosts [
+  c
+]
+replicas 3
+patches!patch {
+  regions [
+    us
+  ]
+}
+`
+	if string(text) != expected {
+		t.Errorf("overlay:\nexpected:\n%s\ngot:\n%s", expected, text)
+	}
+
+	// Processing the overlay against the base must reproduce desired.
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "base.up"), []byte(base), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "overlay.up"), text, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewTemplateEngine().ProcessTemplate(filepath.Join(dir, "overlay.up"))
+	if err != nil {
+		t.Fatalf("ProcessTemplate() failed: %v", err)
+	}
+	if changes := Diff(desiredDoc, result); len(changes) != 0 {
+		t.Errorf("processed overlay differs from desired:\n%s", changes)
+	}
+}
+
+func TestComputeOverlay_Removal(t *testing.T) {
+	base := NewBuilder().Set("a", "1").Block("b", func(b *BlockBuilder) { b.Set("x", "1").Set("y", "2") }).Document()
+	desired := NewBuilder().Block("b", func(b *BlockBuilder) { b.Set("x", "1") }).Document()
+
+	_, err := ComputeOverlay(base, desired, OverlayOptions{})
+	if err == nil || !strings.Contains(err.Error(), "b.y") || !strings.Contains(err.Error(), "a") {
+		t.Errorf("expected removal error naming a and b.y, got %v", err)
+	}
+}
+
+func TestComputeOverlay_NestedAnnotations(t *testing.T) {
+	p := NewParser()
+	parse := func(s string) *Document {
+		doc, err := p.ParseDocument(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("ParseDocument() failed: %v", err)
+		}
+		return doc
+	}
+	base := parse("server {\nhost a\nport!int 80\n}\nhosts [\nx\n]\n")
+	desired := parse("server {\nhost a\nport!string 80\nlimits {\ncpu!int 2\n}\n}\n" +
+		"hosts [\nx\n{\nweight!float 1\n}\n]\n")
+
+	overlay, err := ComputeOverlay(base, desired, OverlayOptions{})
+	if err != nil {
+		t.Fatalf("ComputeOverlay() failed: %v", err)
+	}
+	text, err := Format(overlay)
+	if err != nil {
+		t.Fatalf("Format() failed: %v", err)
+	}
+
+	expected := `server {
+  limits {
+    cpu!int 2
+  }
+  port!string 80
+}
+hosts [
+  {
+    weight!float 1
+  }
+]
+`
+	if string(text) != expected {
+		t.Errorf("overlay:\nexpected:\n%s\ngot:\n%s", expected, text)
+	}
+}
+
+func TestFormat_RoundTrip(t *testing.T) {
+	doc := NewBuilder().
+		Set("plain", "hello world").
+		Set("quoted", `"already quoted"`).
+		Set("padded", "  spaced  ").
+		Set("bracket", "[not a list]").
+		Set("text", "line one\nline two").
+		List("inline", "a", "b").
+		Block("nested", func(b *BlockBuilder) {
+			b.Set("empty", "").List("items", Block{"k": "v"}, []any{"x", "y"})
+		}).
+		SetTyped("users", "table", map[string]any{
+			"columns": []any{"id", "name"},
+			"rows":    []any{[]any{"1", "alice"}, []any{"2", "bob"}},
+		}).
+		Set("after", "x").
+		Document()
+
+	text, err := Format(doc)
+	if err != nil {
+		t.Fatalf("Format() failed: %v", err)
+	}
+	parsed, err := NewParser().ParseDocument(strings.NewReader(string(text)))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v\n%s", err, text)
+	}
+	if changes := Diff(doc, parsed); len(changes) != 0 {
+		t.Errorf("round trip changed the document:\n%s\nformatted:\n%s", changes, text)
+	}
+
+	// Keys that would be parsed differently are rejected
+	for _, key := range []string{"a!b", "a{", "a:"} {
+		if _, err := Format(NewBuilder().Set(key, "v").Document()); err == nil {
+			t.Errorf("expected error formatting key %q", key)
+		}
+	}
+}
@@ -17,14 +17,21 @@ type UseDirective struct {
 // Scanner wraps a bufio.Scanner with additional functionality.
 type Scanner struct {
 	*bufio.Scanner
-	lineNum int
+	lineNum     int
+	annotations map[string]string   // type annotations of nested keys, by path
+	positions   map[string]Position // source positions of keys and list items, by path
+	multiline   map[string]bool     // paths of values written with ``` fences
+	directive   bool                // inside a directive payload, which has no document path
 }
 
 // NewScanner creates a new Scanner from an io.Reader.
 func NewScanner(r io.Reader) *Scanner {
 	return &Scanner{
-		Scanner: bufio.NewScanner(r),
-		lineNum: 0,
+		Scanner:     bufio.NewScanner(r),
+		lineNum:     0,
+		annotations: make(map[string]string),
+		positions:   make(map[string]Position),
+		multiline:   make(map[string]bool),
 	}
 }
 
@@ -37,23 +44,67 @@ func (s *Scanner) NextLine() (int, string, bool) {
 	return s.lineNum, s.Text(), true
 }
 
+// annotate records the type annotation of a nested key.
+func (s *Scanner) annotate(path Path, typ string) {
+	if typ != "" && len(path) > 1 && !s.directive {
+		s.annotations[path.String()] = typ
+	}
+}
+
+// mark records the current line as the source position of path.
+func (s *Scanner) mark(path Path) {
+	if s.directive {
+		return
+	}
+	text := s.Text()
+	column := len(text) - len(strings.TrimLeft(text, " \t")) + 1
+	s.positions[path.String()] = Position{Line: s.lineNum, Column: column}
+}
+
+// fence records that the value at path is written with ``` fences.
+func (s *Scanner) fence(path Path) {
+	if !s.directive {
+		s.multiline[path.String()] = true
+	}
+}
+
 // ParseFunc represents a parsing function type.
 type ParseFunc[T any] func(*Scanner, string) (T, error)
 
+// DirectiveHandler parses the payload of a document-level directive. It
+// receives the scanner positioned after the directive line and the rest of
+// that line following the directive name, e.g. "[a, b]" or "{".
+type DirectiveHandler = ParseFunc[Value]
+
 // Parser provides configurable parsing functionality.
 type Parser struct {
 	dedentFunc    func(string, int) string
 	skipEmptyLine func(string) bool
 	skipComment   func(string) bool
+	directives    map[string]DirectiveHandler
 }
 
 // NewParser creates a new Parser with default configuration.
 func NewParser() *Parser {
-	return &Parser{
+	p := &Parser{
 		dedentFunc:    dedentLines,
 		skipEmptyLine: func(line string) bool { return strings.TrimSpace(line) == "" },
 		skipComment:   func(line string) bool { return strings.HasPrefix(strings.TrimSpace(line), "#") },
+		directives:    make(map[string]DirectiveHandler),
 	}
+	p.RegisterDirective("use", p.parseUseDirective)
+	p.RegisterDirective("lint", p.parseLintDirective)
+	return p
+}
+
+// RegisterDirective registers a handler for the document-level directive
+// !name. The value returned by the handler is recorded in
+// Document.Directives. Registering a built-in name (use, lint) replaces
+// the built-in handler. Lines starting with an unregistered !name are a
+// parse error.
+func (p *Parser) RegisterDirective(name string, handler DirectiveHandler) *Parser {
+	p.directives[name] = handler
+	return p
 }
 
 // WithDedentFunc configures the dedent function.
@@ -77,18 +128,16 @@ func (p *Parser) WithSkipComment(fn func(string) bool) *Parser {
 // ParseDocument parses a UP document from an io.Reader.
 func (p *Parser) ParseDocument(r io.Reader) (*Document, error) {
 	scanner := NewScanner(r)
-	nodes, err := p.parseNodes(scanner)
-	if err != nil {
+	doc := &Document{annotations: scanner.annotations, positions: scanner.positions, multiline: scanner.multiline}
+	if err := p.parseNodes(scanner, doc); err != nil {
 		return nil, err
 	}
 
-	return &Document{Nodes: nodes}, scanner.Err()
+	return doc, scanner.Err()
 }
 
-// parseNodes parses multiple nodes from the scanner.
-func (p *Parser) parseNodes(scanner *Scanner) ([]Node, error) {
-	var nodes []Node
-
+// parseNodes parses top-level nodes and directives from the scanner into doc.
+func (p *Parser) parseNodes(scanner *Scanner, doc *Document) error {
 	for {
 		lineNum, line, ok := scanner.NextLine()
 		if !ok {
@@ -102,45 +151,67 @@ func (p *Parser) parseNodes(scanner *Scanner) ([]Node, error) {
 		trimmedLine := strings.TrimSpace(line)
 
 		// Handle document-level directives
-		if strings.HasPrefix(trimmedLine, "!use") {
-			useNode, err := p.parseUseDirective(scanner, trimmedLine)
-			if err != nil {
-				return nil, fmt.Errorf("line %d: %w", lineNum, err)
-			}
-			nodes = append(nodes, useNode)
-			continue
-		}
-
-		if strings.HasPrefix(trimmedLine, "!lint") {
-			lintNode, err := p.parseLintDirective(scanner, trimmedLine)
+		if strings.HasPrefix(trimmedLine, "!") {
+			directive, err := p.parseDirective(scanner, trimmedLine)
 			if err != nil {
-				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+				return fmt.Errorf("line %d: %w", lineNum, err)
 			}
-			nodes = append(nodes, lintNode)
+			doc.Directives = append(doc.Directives, directive)
 			continue
 		}
 
-		node, err := p.parseLine(scanner, line)
+		node, err := p.parseLine(scanner, line, nil)
 		if err != nil {
-			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			return fmt.Errorf("line %d: %w", lineNum, err)
 		}
-		nodes = append(nodes, node)
+		doc.Nodes = append(doc.Nodes, node)
 	}
 
-	return nodes, nil
+	return nil
 }
 
-// parseUseDirective parses a !use directive: !use [namespace1, namespace2]
-func (p *Parser) parseUseDirective(scanner *Scanner, line string) (Node, error) {
-	line = strings.TrimSpace(line)
-	line = strings.TrimPrefix(line, "!use")
-	line = strings.TrimSpace(line)
+// parseDirective dispatches a directive line to its registered handler.
+// Payload lines are not recorded in the document's positions, annotations
+// and multi-line values, which are keyed by document paths.
+func (p *Parser) parseDirective(scanner *Scanner, line string) (Directive, error) {
+	name, args := splitDirective(line)
+	handler, ok := p.directives[name]
+	if !ok {
+		return Directive{}, fmt.Errorf("unknown directive !%s", name)
+	}
+
+	scanner.directive = true
+	value, err := handler(scanner, args)
+	scanner.directive = false
+	if err != nil {
+		return Directive{}, err
+	}
+	return Directive{Name: name, Value: value}, nil
+}
+
+// splitDirective splits a directive line into its name and arguments.
+func splitDirective(line string) (string, string) {
+	line = strings.TrimPrefix(line, "!")
+	nameEnd := strings.IndexAny(line, " \t[{")
+	if nameEnd == -1 {
+		nameEnd = len(line)
+	}
+	return line[:nameEnd], strings.TrimSpace(line[nameEnd:])
+}
 
+// ParseBlock parses an indented block body up to its closing brace. It is
+// intended for directive handlers whose payload is a block.
+func (p *Parser) ParseBlock(scanner *Scanner) (Block, error) {
+	return p.parseBlock(scanner, nil)
+}
+
+// parseUseDirective parses a !use directive: !use [namespace1, namespace2]
+func (p *Parser) parseUseDirective(scanner *Scanner, args string) (Value, error) {
 	// Parse the namespace list
-	if strings.HasPrefix(line, "[") {
-		namespaces, err := parseInlineList(line)
+	if strings.HasPrefix(args, "[") {
+		namespaces, err := parseInlineList(args)
 		if err != nil {
-			return Node{}, fmt.Errorf("invalid !use directive: %w", err)
+			return nil, fmt.Errorf("invalid !use directive: %w", err)
 		}
 		// Convert []any to []string
 		nsList := make([]string, len(namespaces))
@@ -149,40 +220,28 @@ func (p *Parser) parseUseDirective(scanner *Scanner, line string) (Node, error)
 				nsList[i] = s
 			}
 		}
-		return Node{
-			Key:   "_use",
-			Type:  "directive",
-			Value: UseDirective{Namespaces: nsList},
-		}, nil
+		return UseDirective{Namespaces: nsList}, nil
 	}
 
-	return Node{}, fmt.Errorf("!use directive requires a list: !use [namespace1, namespace2]")
+	return nil, fmt.Errorf("!use directive requires a list: !use [namespace1, namespace2]")
 }
 
 // parseLintDirective parses a !lint directive block
-func (p *Parser) parseLintDirective(scanner *Scanner, line string) (Node, error) {
-	line = strings.TrimSpace(line)
-	line = strings.TrimPrefix(line, "!lint")
-	line = strings.TrimSpace(line)
-
+func (p *Parser) parseLintDirective(scanner *Scanner, args string) (Value, error) {
 	// Expect a block: !lint { ... }
-	if line == "{" {
-		block, err := p.parseBlock(scanner)
+	if args == "{" {
+		block, err := p.ParseBlock(scanner)
 		if err != nil {
-			return Node{}, fmt.Errorf("invalid !lint block: %w", err)
+			return nil, fmt.Errorf("invalid !lint block: %w", err)
 		}
-		return Node{
-			Key:   "_lint",
-			Type:  "directive",
-			Value: block,
-		}, nil
+		return block, nil
 	}
 
-	return Node{}, fmt.Errorf("!lint directive requires a block: !lint { ... }")
+	return nil, fmt.Errorf("!lint directive requires a block: !lint { ... }")
 }
 
-// parseLine parses a single key-value line.
-func (p *Parser) parseLine(scanner *Scanner, line string) (Node, error) {
+// parseLine parses a single key-value line located inside parent.
+func (p *Parser) parseLine(scanner *Scanner, line string, parent Path) (Node, error) {
 	keyPart, valPart, lineOriented := p.splitKeyValue(line)
 	key, typeAnnotation := p.parseKeyAndType(keyPart)
 
@@ -190,6 +249,8 @@ func (p *Parser) parseLine(scanner *Scanner, line string) (Node, error) {
 		Key:  key,
 		Type: typeAnnotation,
 	}
+	path := parent.Key(key)
+	scanner.mark(path)
 
 	// Handle !quoted annotation - preserves or adds literal quotes
 	if typeAnnotation == "quoted" {
@@ -199,10 +260,12 @@ func (p *Parser) parseLine(scanner *Scanner, line string) (Node, error) {
 		}
 		node.Type = "string" // Normalize type to string
 		node.Value = valPart
+		scanner.annotate(path, node.Type)
 		return node, nil
 	}
 
-	value, err := p.parseValue(scanner, node, valPart, lineOriented)
+	scanner.annotate(path, node.Type)
+	value, err := p.parseValue(scanner, node, valPart, lineOriented, path)
 	if err != nil {
 		return Node{}, err
 	}
@@ -272,29 +335,31 @@ func (p *Parser) parseKeyAndType(keyPart string) (string, string) {
 }
 
 // parseValue parses the value part based on its format.
-func (p *Parser) parseValue(scanner *Scanner, node Node, valPart string, lineOriented bool) (Value, error) {
+func (p *Parser) parseValue(scanner *Scanner, node Node, valPart string, lineOriented bool, path Path) (Value, error) {
 	switch {
 	case strings.HasPrefix(valPart, "```"):
+		scanner.fence(path)
 		return p.parseMultiline(scanner, node, valPart)
+	case node.Type == "table" && valPart == "{":
+		// Multi-line table: the body holds columns and rows, not keys
+		return p.parseTable(scanner)
 	case valPart == "{":
-		return p.parseBlock(scanner)
+		return p.parseBlock(scanner, path)
 	case valPart == "[":
-		return p.parseList(scanner)
+		return p.parseList(scanner, path)
 	case strings.HasPrefix(valPart, "[") && strings.HasSuffix(valPart, "]"):
 		// Inline list on same line: key [item1, item2, item3]
 		return parseInlineList(valPart)
 	case strings.HasPrefix(valPart, "{") && strings.Contains(valPart, "}"):
 		// Inline block: key { ... } - parse as single-line block
-		return p.parseInlineBlock(valPart)
-	case node.Type == "table" && strings.HasPrefix(valPart, "{"):
-		return p.parseTable(scanner)
+		return p.parseInlineBlock(scanner, valPart, path)
 	default:
 		return valPart, nil
 	}
 }
 
 // parseInlineBlock parses a single-line block: { key1 value1, key2 value2 }
-func (p *Parser) parseInlineBlock(s string) (Block, error) {
+func (p *Parser) parseInlineBlock(scanner *Scanner, s string, path Path) (Block, error) {
 	s = strings.TrimSpace(s)
 	s = strings.TrimPrefix(s, "{")
 	s = strings.TrimSuffix(s, "}")
@@ -314,7 +379,9 @@ func (p *Parser) parseInlineBlock(s string) (Block, error) {
 		}
 		// Each part is "key value" or "key!type value"
 		keyPart, valPart, _ := p.splitKeyValue(part)
-		key, _ := p.parseKeyAndType(keyPart)
+		key, typeAnnotation := p.parseKeyAndType(keyPart)
+		scanner.annotate(path.Key(key), typeAnnotation)
+		scanner.mark(path.Key(key))
 		block[key] = valPart
 	}
 	return block, nil
@@ -347,8 +414,8 @@ func (p *Parser) parseMultiline(scanner *Scanner, node Node, line string) (strin
 	return text, nil
 }
 
-// parseBlock parses a standard { ... } block of statements.
-func (p *Parser) parseBlock(scanner *Scanner) (Block, error) {
+// parseBlock parses a standard { ... } block of statements located at path.
+func (p *Parser) parseBlock(scanner *Scanner, path Path) (Block, error) {
 	block := make(Block)
 
 	for {
@@ -365,7 +432,7 @@ func (p *Parser) parseBlock(scanner *Scanner) (Block, error) {
 			continue
 		}
 
-		node, err := p.parseLine(scanner, line)
+		node, err := p.parseLine(scanner, line, path)
 		if err != nil {
 			return nil, err
 		}
@@ -375,8 +442,8 @@ func (p *Parser) parseBlock(scanner *Scanner) (Block, error) {
 	return block, nil
 }
 
-// parseList parses a [...] list.
-func (p *Parser) parseList(scanner *Scanner) (List, error) {
+// parseList parses a [...] list located at path.
+func (p *Parser) parseList(scanner *Scanner, path Path) (List, error) {
 	var list List
 
 	for {
@@ -393,7 +460,7 @@ func (p *Parser) parseList(scanner *Scanner) (List, error) {
 			continue
 		}
 
-		item, err := p.parseListItem(scanner, line)
+		item, err := p.parseListItem(scanner, line, path.Index(len(list)))
 		if err != nil {
 			return nil, err
 		}
@@ -404,10 +471,11 @@ func (p *Parser) parseList(scanner *Scanner) (List, error) {
 }
 
 // parseListItem parses a single list item.
-func (p *Parser) parseListItem(scanner *Scanner, line string) (Value, error) {
+func (p *Parser) parseListItem(scanner *Scanner, line string, path Path) (Value, error) {
+	scanner.mark(path)
 	switch {
 	case strings.HasPrefix(line, "{"):
-		return p.parseBlock(scanner)
+		return p.parseBlock(scanner, path)
 	case strings.HasPrefix(line, "["):
 		return parseInlineList(line)
 	default:
@@ -109,6 +109,48 @@ port!int 8080
 	}
 }
 
+func TestParseDocument_Table(t *testing.T) {
+	input := `users!table {
+columns [id, name]
+rows {
+[1, alice]
+[2, bob]
+}
+}
+server!custom {
+columns [a]
+}`
+
+	p := NewParser()
+	doc, err := p.ParseDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+	if len(doc.Nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %d", len(doc.Nodes))
+	}
+
+	table, ok := doc.Nodes[0].Value.(map[string]any)
+	if !ok {
+		t.Fatalf("Expected table map, got %T", doc.Nodes[0].Value)
+	}
+	if !Equal(table["columns"], List{"id", "name"}) {
+		t.Errorf("Expected columns [id, name], got %v", table["columns"])
+	}
+	rows, ok := table["rows"].([]any)
+	if !ok || len(rows) != 2 {
+		t.Fatalf("Expected 2 rows, got %v", table["rows"])
+	}
+	if !Equal(rows[1], List{"2", "bob"}) {
+		t.Errorf("Expected row [2, bob], got %v", rows[1])
+	}
+
+	// Other annotations still introduce ordinary blocks
+	if _, ok := doc.Nodes[1].Value.(Block); !ok {
+		t.Errorf("Expected Block for server!custom, got %T", doc.Nodes[1].Value)
+	}
+}
+
 func TestParseDocument_List(t *testing.T) {
 	input := `items [
 apple
@@ -414,7 +456,7 @@ func TestParseDocument_InlineList(t *testing.T) {
 }
 
 func TestParseDocument_UseDirective(t *testing.T) {
-	input := "!use [time, id, faker, random]"
+	input := "!use [time, id, faker, random]\n_use user-value"
 
 	p := NewParser()
 	doc, err := p.ParseDocument(strings.NewReader(input))
@@ -422,21 +464,17 @@ func TestParseDocument_UseDirective(t *testing.T) {
 		t.Fatalf("ParseDocument() failed: %v", err)
 	}
 
-	if len(doc.Nodes) != 1 {
-		t.Fatalf("Expected 1 node, got %d", len(doc.Nodes))
-	}
-
-	if doc.Nodes[0].Key != "_use" {
-		t.Errorf("Expected key '_use', got '%s'", doc.Nodes[0].Key)
+	if len(doc.Directives) != 1 {
+		t.Fatalf("Expected 1 directive, got %d", len(doc.Directives))
 	}
 
-	if doc.Nodes[0].Type != "directive" {
-		t.Errorf("Expected type 'directive', got '%s'", doc.Nodes[0].Type)
+	if doc.Directives[0].Name != "use" {
+		t.Errorf("Expected directive 'use', got '%s'", doc.Directives[0].Name)
 	}
 
-	useDir, ok := doc.Nodes[0].Value.(UseDirective)
+	useDir, ok := doc.Directives[0].Value.(UseDirective)
 	if !ok {
-		t.Fatalf("Expected UseDirective type, got %T", doc.Nodes[0].Value)
+		t.Fatalf("Expected UseDirective type, got %T", doc.Directives[0].Value)
 	}
 
 	expected := []string{"time", "id", "faker", "random"}
@@ -449,6 +487,15 @@ func TestParseDocument_UseDirective(t *testing.T) {
 			t.Errorf("Expected namespace[%d] '%s', got '%s'", i, exp, useDir.Namespaces[i])
 		}
 	}
+
+	if strings.Join(doc.Uses(), ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected Uses() %v, got %v", expected, doc.Uses())
+	}
+
+	// User keys beginning with an underscore are regular nodes
+	if len(doc.Nodes) != 1 || doc.Nodes[0].Key != "_use" || doc.Nodes[0].Value != "user-value" {
+		t.Errorf("Expected user node '_use', got %+v", doc.Nodes)
+	}
 }
 
 func TestParseDocument_LintDirective(t *testing.T) {
@@ -463,21 +510,17 @@ func TestParseDocument_LintDirective(t *testing.T) {
 		t.Fatalf("ParseDocument() failed: %v", err)
 	}
 
-	if len(doc.Nodes) != 1 {
-		t.Fatalf("Expected 1 node, got %d", len(doc.Nodes))
-	}
-
-	if doc.Nodes[0].Key != "_lint" {
-		t.Errorf("Expected key '_lint', got '%s'", doc.Nodes[0].Key)
+	if len(doc.Nodes) != 0 {
+		t.Fatalf("Expected 0 nodes, got %d", len(doc.Nodes))
 	}
 
-	if doc.Nodes[0].Type != "directive" {
-		t.Errorf("Expected type 'directive', got '%s'", doc.Nodes[0].Type)
+	if len(doc.Directives) != 1 || doc.Directives[0].Name != "lint" {
+		t.Fatalf("Expected a single lint directive, got %+v", doc.Directives)
 	}
 
-	block, ok := doc.Nodes[0].Value.(Block)
+	block, ok := doc.Directives[0].Value.(Block)
 	if !ok {
-		t.Fatalf("Expected Block type, got %T", doc.Nodes[0].Value)
+		t.Fatalf("Expected Block type, got %T", doc.Directives[0].Value)
 	}
 
 	if block["no-empty-values"] != "warning" {
@@ -487,6 +530,80 @@ func TestParseDocument_LintDirective(t *testing.T) {
 	if block["require-type-annotations"] != "error" {
 		t.Errorf("Expected require-type-annotations error, got %v", block["require-type-annotations"])
 	}
+
+	expected := []LintRule{
+		{Name: "no-empty-values", Level: "warning"},
+		{Name: "require-type-annotations", Level: "error"},
+	}
+	rules := doc.LintRules()
+	if len(rules) != len(expected) {
+		t.Fatalf("Expected %d lint rules, got %d", len(expected), len(rules))
+	}
+	for i, exp := range expected {
+		if rules[i] != exp {
+			t.Errorf("Expected rule[%d] %+v, got %+v", i, exp, rules[i])
+		}
+	}
+}
+
+func TestParseDocument_CustomDirective(t *testing.T) {
+	input := `!version 2
+!schema {
+  name!type string
+}
+name demo`
+
+	p := NewParser()
+	p.RegisterDirective("version", func(scanner *Scanner, args string) (Value, error) {
+		return args, nil
+	})
+	p.RegisterDirective("schema", func(scanner *Scanner, args string) (Value, error) {
+		return p.ParseBlock(scanner)
+	})
+
+	doc, err := p.ParseDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	if len(doc.Nodes) != 1 || doc.Nodes[0].Key != "name" {
+		t.Errorf("Expected a single 'name' node, got %+v", doc.Nodes)
+	}
+
+	version, ok := doc.Directive("version")
+	if !ok || version.Value != "2" {
+		t.Errorf("Expected version directive '2', got %+v", version)
+	}
+
+	schema, ok := doc.Directive("schema")
+	if !ok {
+		t.Fatal("Expected schema directive")
+	}
+	block, ok := schema.Value.(Block)
+	if !ok || block["name"] != "string" {
+		t.Errorf("Expected schema block with name, got %#v", schema.Value)
+	}
+
+	// Payload keys must not shadow the positions and annotations of
+	// document keys with the same names.
+	doc, err = p.ParseDocument(strings.NewReader("name demo\n!schema {\n  name!type string\n  server {\n    port!int 1\n  }\n}\n"))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+	if pos := doc.Position("name"); pos != (Position{Line: 1, Column: 1}) {
+		t.Errorf("Expected name at 1:1, got %s", pos)
+	}
+	if pos := doc.Position("server"); pos.IsValid() {
+		t.Errorf("Expected no position for directive key server, got %s", pos)
+	}
+	if typ := doc.annotation(Path{{Key: "server"}, {Key: "port"}}); typ != "" {
+		t.Errorf("Expected no annotation for directive key server.port, got %q", typ)
+	}
+
+	_, err = NewParser().ParseDocument(strings.NewReader("!require [x]\n"))
+	if err == nil || !strings.Contains(err.Error(), "unknown directive !require") {
+		t.Errorf("Expected unknown directive error, got %v", err)
+	}
 }
 
 func TestParseDocument_TraditionalQuotedValues(t *testing.T) {
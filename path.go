@@ -0,0 +1,322 @@
+package up
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PathElem is a single step in a Path: either a key or a list index.
+type PathElem struct {
+	Key     string // Key name when IsIndex is false
+	Index   int    // List index when IsIndex is true
+	IsIndex bool
+}
+
+// Path is a concrete location inside a document, such as server.port or
+// servers[2].host. Paths use the same syntax as queries and !patch keys,
+// without wildcards, slices or filters.
+type Path []PathElem
+
+// ParsePath parses a concrete path such as "servers[0].host".
+// Keys containing '.', '[' or ']' can be written as ["quoted.key"].
+func ParsePath(s string) (Path, error) {
+	steps, err := parseSteps(s)
+	if err != nil {
+		return nil, err
+	}
+
+	path := make(Path, 0, len(steps))
+	for _, st := range steps {
+		if st.recursive {
+			return nil, fmt.Errorf("invalid path %q: recursive descent is not allowed", s)
+		}
+		switch st.kind {
+		case stepKey:
+			path = append(path, PathElem{Key: st.key})
+		case stepIndex:
+			if st.index < 0 {
+				return nil, fmt.Errorf("invalid path %q: negative index", s)
+			}
+			path = append(path, PathElem{Index: st.index, IsIndex: true})
+		default:
+			return nil, fmt.Errorf("invalid path %q: wildcards, slices and filters are not allowed", s)
+		}
+	}
+	return path, nil
+}
+
+// Key returns a copy of p extended with a key element.
+func (p Path) Key(key string) Path {
+	return appendElem(p, PathElem{Key: key})
+}
+
+// Index returns a copy of p extended with a list index element.
+func (p Path) Index(i int) Path {
+	return appendElem(p, PathElem{Index: i, IsIndex: true})
+}
+
+// String renders the path in query syntax, e.g. servers[0].host.
+func (p Path) String() string {
+	var sb strings.Builder
+	for i, e := range p {
+		switch {
+		case e.IsIndex:
+			sb.WriteString("[" + strconv.Itoa(e.Index) + "]")
+		case needsQuoting(e.Key):
+			sb.WriteString("[" + strconv.Quote(e.Key) + "]")
+		default:
+			if i > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(e.Key)
+		}
+	}
+	return sb.String()
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p Path) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *Path) UnmarshalText(text []byte) error {
+	parsed, err := ParsePath(string(text))
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// needsQuoting reports whether a key must be written in bracket form.
+func needsQuoting(key string) bool {
+	return key == "" || key == "*" || strings.ContainsAny(key, ".[]\" \t")
+}
+
+// child is a single entry of a container value.
+type child struct {
+	elem  PathElem
+	value Value
+}
+
+// children returns the entries of a container value in deterministic order.
+// Blocks and tables are visited in sorted key order, lists in index order.
+func children(v Value) []child {
+	switch v := v.(type) {
+	case Block:
+		return mapChildren(v)
+	case map[string]any:
+		return mapChildren(v)
+	case List:
+		return listChildren(v)
+	case []any:
+		return listChildren(v)
+	default:
+		return nil
+	}
+}
+
+func mapChildren[M ~map[string]V, V any](m M) []child {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]child, len(keys))
+	for i, k := range keys {
+		result[i] = child{elem: PathElem{Key: k}, value: m[k]}
+	}
+	return result
+}
+
+func listChildren[L ~[]V, V any](l L) []child {
+	result := make([]child, len(l))
+	for i, item := range l {
+		result[i] = child{elem: PathElem{Index: i, IsIndex: true}, value: item}
+	}
+	return result
+}
+
+// documentChildren returns the top-level nodes of a document in order.
+func documentChildren(doc *Document) []child {
+	result := make([]child, len(doc.Nodes))
+	for i, node := range doc.Nodes {
+		result[i] = child{elem: PathElem{Key: node.Key}, value: node.Value}
+	}
+	return result
+}
+
+// lookupPath returns the value at a concrete path.
+func lookupPath(doc *Document, path Path) (Value, bool) {
+	if len(path) == 0 || path[0].IsIndex {
+		return nil, false
+	}
+
+	idx := doc.nodeIndex(path[0].Key)
+	if idx == -1 {
+		return nil, false
+	}
+
+	current := doc.Nodes[idx].Value
+	for _, e := range path[1:] {
+		next, ok := childValue(current, e)
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// childValue returns the entry of a container value addressed by e.
+func childValue(v Value, e PathElem) (Value, bool) {
+	if e.IsIndex {
+		switch l := v.(type) {
+		case List:
+			if e.Index >= 0 && e.Index < len(l) {
+				return l[e.Index], true
+			}
+		case []any:
+			if e.Index >= 0 && e.Index < len(l) {
+				return l[e.Index], true
+			}
+		}
+		return nil, false
+	}
+
+	switch m := v.(type) {
+	case Block:
+		val, ok := m[e.Key]
+		return val, ok
+	case map[string]any:
+		val, ok := m[e.Key]
+		return val, ok
+	}
+	return nil, false
+}
+
+// setPath stores value at a concrete path, mutating blocks and lists in place.
+// When create is true, missing top-level nodes and intermediate blocks are
+// created; otherwise every parent along the path must already exist.
+func setPath(doc *Document, path Path, value Value, create bool) error {
+	if len(path) == 0 {
+		return fmt.Errorf("empty path")
+	}
+	if path[0].IsIndex {
+		return fmt.Errorf("path %s: document root is not a list", path)
+	}
+
+	idx := doc.nodeIndex(path[0].Key)
+	if idx == -1 {
+		if !create {
+			return fmt.Errorf("path %s: key %q not found", path, path[0].Key)
+		}
+		doc.Nodes = append(doc.Nodes, Node{Key: path[0].Key})
+		idx = len(doc.Nodes) - 1
+	}
+
+	if len(path) == 1 {
+		doc.Nodes[idx].Value = value
+		return nil
+	}
+
+	updated, err := setIn(doc.Nodes[idx].Value, path, 1, value, create)
+	if err != nil {
+		return err
+	}
+	doc.Nodes[idx].Value = updated
+	return nil
+}
+
+// setIn stores value at path[pos:] relative to container and returns the
+// (possibly newly created) container.
+func setIn(container Value, path Path, pos int, value Value, create bool) (Value, error) {
+	if path[pos].IsIndex {
+		switch l := container.(type) {
+		case List:
+			return container, setListItem(l, path, pos, value, create)
+		case []any:
+			return container, setListItem(l, path, pos, value, create)
+		default:
+			return nil, fmt.Errorf("path %s: %s is not a list", path, path[:pos])
+		}
+	}
+
+	switch b := container.(type) {
+	case Block:
+		return container, setMapEntry(b, path, pos, value, create)
+	case map[string]any:
+		return container, setMapEntry(b, path, pos, value, create)
+	case nil:
+		if !create {
+			return nil, fmt.Errorf("path %s: %s not found", path, path[:pos])
+		}
+		block := make(Block)
+		return block, setMapEntry(block, path, pos, value, create)
+	default:
+		return nil, fmt.Errorf("path %s: %s is not a block", path, path[:pos])
+	}
+}
+
+// setListItem stores value at path[pos:] where path[pos] indexes l.
+func setListItem[L ~[]V, V any](l L, path Path, pos int, value Value, create bool) error {
+	e := path[pos]
+	if e.Index < 0 || e.Index >= len(l) {
+		return fmt.Errorf("path %s: index %d out of range", path, e.Index)
+	}
+	if pos == len(path)-1 {
+		return storeElem(&l[e.Index], path, value)
+	}
+	updated, err := setIn(l[e.Index], path, pos+1, value, create)
+	if err != nil {
+		return err
+	}
+	return storeElem(&l[e.Index], path, updated)
+}
+
+// setMapEntry stores value at path[pos:] where path[pos] is a key of m.
+func setMapEntry[M ~map[string]V, V any](m M, path Path, pos int, value Value, create bool) error {
+	e := path[pos]
+	if pos == len(path)-1 {
+		var elem V
+		if err := storeElem(&elem, path, value); err != nil {
+			return err
+		}
+		m[e.Key] = elem
+		return nil
+	}
+	next, ok := m[e.Key]
+	if !ok && !create {
+		return fmt.Errorf("path %s: key %q not found", path, e.Key)
+	}
+	updated, err := setIn(next, path, pos+1, value, create)
+	if err != nil {
+		return err
+	}
+	var elem V
+	if err := storeElem(&elem, path, updated); err != nil {
+		return err
+	}
+	m[e.Key] = elem
+	return nil
+}
+
+// storeElem stores value in an element of a list or block whose element
+// type is V. A nil value stores the zero element.
+func storeElem[V any](elem *V, path Path, value Value) error {
+	if value == nil {
+		var zero V
+		*elem = zero
+		return nil
+	}
+	v, ok := value.(V)
+	if !ok {
+		return fmt.Errorf("path %s: cannot store %T here", path, value)
+	}
+	*elem = v
+	return nil
+}
@@ -0,0 +1,40 @@
+package up
+
+import (
+	"fmt"
+)
+
+// IsValid reports whether the position refers to a source line.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String renders the position as line:column.
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Position returns the source position of the value at path. Values
+// without a position of their own, such as inline list items, report the
+// position of their nearest ancestor. Documents that were not parsed
+// return the zero Position.
+func (d *Document) Position(path string) Position {
+	p, err := ParsePath(path)
+	if err != nil {
+		return Position{}
+	}
+	return d.position(p)
+}
+
+// position returns the position recorded for p or its nearest ancestor.
+func (d *Document) position(p Path) Position {
+	for ; len(p) > 0; p = p[:len(p)-1] {
+		if pos, ok := d.positions[p.String()]; ok {
+			return pos
+		}
+	}
+	return Position{}
+}
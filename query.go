@@ -0,0 +1,412 @@
+package up
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Query is a compiled selector expression that can be evaluated against
+// documents. The syntax extends the key paths accepted by !patch:
+//
+//	server.port           key lookup
+//	servers[0].host       list index (negative indexes count from the end)
+//	servers[*].host       every element of a list or block
+//	server.*              every entry of a block
+//	servers[1:3]          list slice, either bound may be omitted
+//	servers[name=web].cpu list elements whose key equals a value (also !=)
+//	..port                recursive descent: port at any depth
+//	["dotted.key"]        quoted key
+type Query struct {
+	expr  string
+	steps []step
+}
+
+// Match is a single value selected by a query along with its concrete path.
+type Match struct {
+	Path  Path
+	Value Value
+}
+
+// stepKind identifies the kind of a query step.
+type stepKind int
+
+const (
+	stepKey stepKind = iota
+	stepIndex
+	stepWildcard
+	stepSlice
+	stepFilter
+)
+
+// step is a single compiled selector.
+type step struct {
+	kind      stepKind
+	recursive bool // preceded by ".."
+
+	key   string // stepKey, and the field name for stepFilter
+	index int    // stepIndex
+
+	start, end       int // stepSlice
+	hasStart, hasEnd bool
+
+	negate bool   // stepFilter uses != instead of =
+	value  string // stepFilter comparison value
+}
+
+// CompileQuery parses a selector expression.
+func CompileQuery(expr string) (*Query, error) {
+	steps, err := parseSteps(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &Query{expr: expr, steps: steps}, nil
+}
+
+// MustCompileQuery is like CompileQuery but panics if the expression is invalid.
+func MustCompileQuery(expr string) *Query {
+	q, err := CompileQuery(expr)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// Select compiles expr and evaluates it against doc.
+func Select(doc *Document, expr string) ([]Match, error) {
+	q, err := CompileQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+	return q.Select(doc), nil
+}
+
+// String returns the source expression of the query.
+func (q *Query) String() string {
+	return q.expr
+}
+
+// IsConcrete reports whether the query addresses at most one location,
+// i.e. it consists only of keys and non-negative indexes.
+func (q *Query) IsConcrete() bool {
+	for _, st := range q.steps {
+		if st.recursive {
+			return false
+		}
+		if st.kind != stepKey && (st.kind != stepIndex || st.index < 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// Select evaluates the query against doc and returns all matches in
+// document order. Blocks are traversed in sorted key order.
+func (q *Query) Select(doc *Document) []Match {
+	if len(q.steps) == 0 {
+		return nil
+	}
+
+	// The first step is evaluated against the document's top-level nodes.
+	root := documentChildren(doc)
+	current := applyStep(q.steps[0], nil, root)
+	for _, st := range q.steps[1:] {
+		var next []Match
+		for _, m := range current {
+			next = append(next, applyStep(st, m.Path, children(m.Value))...)
+		}
+		current = next
+	}
+	return current
+}
+
+// First returns the first match of the query, if any.
+func (q *Query) First(doc *Document) (Match, bool) {
+	matches := q.Select(doc)
+	if len(matches) == 0 {
+		return Match{}, false
+	}
+	return matches[0], true
+}
+
+// applyStep evaluates a single step against the entries of a container
+// located at base.
+func applyStep(st step, base Path, entries []child) []Match {
+	if !st.recursive {
+		return selectEntries(st, base, entries)
+	}
+
+	// Recursive descent: apply the step at this level, then at every
+	// level below it.
+	matches := selectEntries(st, base, entries)
+	for _, c := range entries {
+		p := appendElem(base, c.elem)
+		matches = append(matches, applyStep(st, p, children(c.value))...)
+	}
+	return matches
+}
+
+// selectEntries evaluates a non-recursive step against container entries.
+func selectEntries(st step, base Path, entries []child) []Match {
+	var matches []Match
+	add := func(c child) {
+		matches = append(matches, Match{Path: appendElem(base, c.elem), Value: c.value})
+	}
+
+	switch st.kind {
+	case stepKey:
+		for _, c := range entries {
+			if !c.elem.IsIndex && c.elem.Key == st.key {
+				add(c)
+			}
+		}
+	case stepWildcard:
+		for _, c := range entries {
+			add(c)
+		}
+	case stepIndex:
+		if !isListEntries(entries) {
+			break
+		}
+		i := st.index
+		if i < 0 {
+			i += len(entries)
+		}
+		if i >= 0 && i < len(entries) {
+			add(entries[i])
+		}
+	case stepSlice:
+		if !isListEntries(entries) {
+			break
+		}
+		start, end := sliceBounds(st, len(entries))
+		for i := start; i < end; i++ {
+			add(entries[i])
+		}
+	case stepFilter:
+		for _, c := range entries {
+			if filterMatches(st, c.value) {
+				add(c)
+			}
+		}
+	}
+	return matches
+}
+
+// isListEntries reports whether entries were produced from a list.
+func isListEntries(entries []child) bool {
+	return len(entries) > 0 && entries[0].elem.IsIndex
+}
+
+// sliceBounds resolves slice bounds against a list of length n.
+func sliceBounds(st step, n int) (int, int) {
+	start, end := 0, n
+	if st.hasStart {
+		start = st.start
+		if start < 0 {
+			start += n
+		}
+	}
+	if st.hasEnd {
+		end = st.end
+		if end < 0 {
+			end += n
+		}
+	}
+	start = max(0, min(start, n))
+	end = max(start, min(end, n))
+	return start, end
+}
+
+// filterMatches reports whether v is a block whose key compares as required.
+func filterMatches(st step, v Value) bool {
+	field, ok := childValue(v, PathElem{Key: st.key})
+	if !ok {
+		return st.negate && isBlockLike(v)
+	}
+	s, ok := field.(string)
+	if !ok {
+		return false
+	}
+	return (s == st.value) != st.negate
+}
+
+// isBlockLike reports whether v is a Block or a raw map.
+func isBlockLike(v Value) bool {
+	switch v.(type) {
+	case Block, map[string]any:
+		return true
+	}
+	return false
+}
+
+// appendElem returns a new path with e appended to base.
+func appendElem(base Path, e PathElem) Path {
+	p := make(Path, len(base), len(base)+1)
+	copy(p, base)
+	return append(p, e)
+}
+
+// parseSteps tokenizes a path or query expression into steps.
+func parseSteps(expr string) ([]step, error) {
+	var steps []step
+	s := strings.TrimSpace(expr)
+	if s == "" {
+		return nil, fmt.Errorf("empty path expression")
+	}
+
+	recursive := false
+	first := true
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, ".."):
+			if recursive {
+				return nil, fmt.Errorf("invalid expression %q: unexpected '..'", expr)
+			}
+			recursive = true
+			s = s[2:]
+			if s == "" {
+				return nil, fmt.Errorf("invalid expression %q: '..' must be followed by a selector", expr)
+			}
+			continue
+		case s[0] == '.':
+			if first || recursive {
+				return nil, fmt.Errorf("invalid expression %q: unexpected '.'", expr)
+			}
+			s = s[1:]
+			if s == "" || s[0] == '.' || s[0] == '[' {
+				return nil, fmt.Errorf("invalid expression %q: empty key", expr)
+			}
+			st, rest := parseKeyStep(s)
+			steps = append(steps, st)
+			s = rest
+		case s[0] == '[':
+			end, err := findBracketEnd(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expression %q: %w", expr, err)
+			}
+			st, err := parseBracket(s[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid expression %q: %w", expr, err)
+			}
+			st.recursive = recursive
+			steps = append(steps, st)
+			s = s[end+1:]
+		case s[0] == ']':
+			return nil, fmt.Errorf("invalid expression %q: unexpected ']'", expr)
+		default:
+			if !first && !recursive {
+				return nil, fmt.Errorf("invalid expression %q: missing '.' before %q", expr, s)
+			}
+			st, rest := parseKeyStep(s)
+			st.recursive = recursive
+			steps = append(steps, st)
+			s = rest
+		}
+		recursive = false
+		first = false
+	}
+	return steps, nil
+}
+
+// parseKeyStep reads a bare key (or *) up to the next '.' or '['.
+func parseKeyStep(s string) (step, string) {
+	end := strings.IndexAny(s, ".[]")
+	if end == -1 {
+		end = len(s)
+	}
+	key := s[:end]
+	if key == "*" {
+		return step{kind: stepWildcard}, s[end:]
+	}
+	return step{kind: stepKey, key: key}, s[end:]
+}
+
+// findBracketEnd returns the index of the ']' closing the bracket at s[0],
+// skipping over quoted strings.
+func findBracketEnd(s string) (int, error) {
+	inQuote := false
+	for i := 1; i < len(s); i++ {
+		switch {
+		case inQuote && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inQuote = !inQuote
+		case !inQuote && s[i] == ']':
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unterminated '['")
+}
+
+// parseBracket parses the contents of a [...] selector.
+func parseBracket(inner string) (step, error) {
+	inner = strings.TrimSpace(inner)
+	switch {
+	case inner == "":
+		return step{}, fmt.Errorf("empty selector []")
+	case inner == "*":
+		return step{kind: stepWildcard}, nil
+	case strings.HasPrefix(inner, "\""):
+		key, err := strconv.Unquote(inner)
+		if err != nil {
+			return step{}, fmt.Errorf("invalid quoted key %s", inner)
+		}
+		return step{kind: stepKey, key: key}, nil
+	case strings.Contains(inner, "="):
+		return parseFilter(inner)
+	case strings.Contains(inner, ":"):
+		return parseSlice(inner)
+	default:
+		i, err := strconv.Atoi(inner)
+		if err != nil {
+			return step{}, fmt.Errorf("invalid selector [%s]", inner)
+		}
+		return step{kind: stepIndex, index: i}, nil
+	}
+}
+
+// parseFilter parses a key=value or key!=value selector.
+func parseFilter(inner string) (step, error) {
+	st := step{kind: stepFilter}
+	key, value, _ := strings.Cut(inner, "=")
+	if strings.HasSuffix(key, "!") {
+		st.negate = true
+		key = strings.TrimSuffix(key, "!")
+	}
+	st.key = strings.TrimSpace(key)
+	if st.key == "" {
+		return step{}, fmt.Errorf("filter [%s] has no key", inner)
+	}
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "\"") {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return step{}, fmt.Errorf("invalid quoted value in filter [%s]", inner)
+		}
+		value = unquoted
+	}
+	st.value = value
+	return st, nil
+}
+
+// parseSlice parses a start:end selector.
+func parseSlice(inner string) (step, error) {
+	st := step{kind: stepSlice}
+	startStr, endStr, _ := strings.Cut(inner, ":")
+	if startStr = strings.TrimSpace(startStr); startStr != "" {
+		n, err := strconv.Atoi(startStr)
+		if err != nil {
+			return step{}, fmt.Errorf("invalid slice start in [%s]", inner)
+		}
+		st.start, st.hasStart = n, true
+	}
+	if endStr = strings.TrimSpace(endStr); endStr != "" {
+		n, err := strconv.Atoi(endStr)
+		if err != nil {
+			return step{}, fmt.Errorf("invalid slice end in [%s]", inner)
+		}
+		st.end, st.hasEnd = n, true
+	}
+	return st, nil
+}
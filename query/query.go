@@ -0,0 +1,33 @@
+// Package query selects values from UP documents with selector
+// expressions such as servers[*].host, servers[name=web].cpu, ..port and
+// servers[1:3]; see up.Query for the full syntax.
+//
+// The evaluator lives in package up, where ParsePath and !patch keys share
+// its syntax. This package is the entry point for code that only needs to
+// query documents.
+package query
+
+import (
+	up "github.com/uplang/go"
+)
+
+// Query is a compiled selector expression.
+type Query = up.Query
+
+// Match is a single value selected by a query along with its concrete path.
+type Match = up.Match
+
+// Compile parses a selector expression.
+func Compile(expr string) (*Query, error) {
+	return up.CompileQuery(expr)
+}
+
+// MustCompile is like Compile but panics if the expression is invalid.
+func MustCompile(expr string) *Query {
+	return up.MustCompileQuery(expr)
+}
+
+// Select compiles expr and evaluates it against doc.
+func Select(doc *up.Document, expr string) ([]Match, error) {
+	return up.Select(doc, expr)
+}
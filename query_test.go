@@ -0,0 +1,150 @@
+package up
+
+import (
+	"strings"
+	"testing"
+)
+
+const queryTestDoc = `name demo
+server {
+port!int 8080
+host localhost
+}
+servers [
+{
+name web
+cpu 2
+port 80
+}
+{
+name db
+cpu 4
+port 5432
+}
+{
+name cache
+cpu 1
+}
+]
+tags [a, b, c, d]
+`
+
+func parseQueryTestDoc(t *testing.T) *Document {
+	t.Helper()
+	doc, err := NewParser().ParseDocument(strings.NewReader(queryTestDoc))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+	return doc
+}
+
+func TestQuerySelect(t *testing.T) {
+	doc := parseQueryTestDoc(t)
+
+	tests := []struct {
+		expr     string
+		expected []string // "path=value" for scalar matches
+	}{
+		{"name", []string{"name=demo"}},
+		{"server.port", []string{"server.port=8080"}},
+		{"servers[*].name", []string{"servers[0].name=web", "servers[1].name=db", "servers[2].name=cache"}},
+		{"servers[name=db].cpu", []string{"servers[1].cpu=4"}},
+		{"servers[name!=db].name", []string{"servers[0].name=web", "servers[2].name=cache"}},
+		{"servers[-1].name", []string{"servers[2].name=cache"}},
+		{"servers[0:2].cpu", []string{"servers[0].cpu=2", "servers[1].cpu=4"}},
+		{"tags[1:]", []string{"tags[1]=b", "tags[2]=c", "tags[3]=d"}},
+		{"tags[:-2]", []string{"tags[0]=a", "tags[1]=b"}},
+		{"..port", []string{"server.port=8080", "servers[0].port=80", "servers[1].port=5432"}},
+		{"server.*", []string{"server.host=localhost", "server.port=8080"}},
+		{"missing.key", nil},
+		{"name[0]", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			matches, err := Select(doc, tt.expr)
+			if err != nil {
+				t.Fatalf("Select(%q) failed: %v", tt.expr, err)
+			}
+
+			var got []string
+			for _, m := range matches {
+				got = append(got, m.Path.String()+"="+m.Value.(string))
+			}
+			if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("Select(%q):\nexpected: %v\ngot:      %v", tt.expr, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompileQuery_Errors(t *testing.T) {
+	for _, expr := range []string{"", "a..", "a.", ".a", "a[", "a[]", "a[x]", "a]b", "a[1:x]", "a[=x]"} {
+		if _, err := CompileQuery(expr); err == nil {
+			t.Errorf("CompileQuery(%q) expected error", expr)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	path, err := ParsePath(`servers[2]["dotted.key"].host`)
+	if err != nil {
+		t.Fatalf("ParsePath() failed: %v", err)
+	}
+	if len(path) != 4 || !path[1].IsIndex || path[1].Index != 2 || path[2].Key != "dotted.key" {
+		t.Fatalf("unexpected path: %#v", path)
+	}
+	if path.String() != `servers[2]["dotted.key"].host` {
+		t.Errorf("Path.String() = %s", path.String())
+	}
+
+	for _, expr := range []string{"servers[*]", "..port", "servers[-1]", "a[name=x]"} {
+		if _, err := ParsePath(expr); err == nil {
+			t.Errorf("ParsePath(%q) expected error", expr)
+		}
+	}
+}
+
+func TestTemplatePatchSelectors(t *testing.T) {
+	input := `servers [
+{
+name web
+cpu 2
+}
+{
+name db
+cpu 4
+}
+]
+patches!patch {
+servers[name=db].cpu 8
+servers[*].region eu
+}
+`
+
+	doc, err := NewTemplateEngine().ProcessTemplateFromReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ProcessTemplateFromReader() failed: %v", err)
+	}
+
+	for expr, expected := range map[string]string{
+		"servers[0].cpu":    "2",
+		"servers[1].cpu":    "8",
+		"servers[0].region": "eu",
+		"servers[1].region": "eu",
+	} {
+		m, ok := MustCompileQuery(expr).First(doc)
+		if !ok || m.Value != expected {
+			t.Errorf("%s: expected %q, got %v", expr, expected, m.Value)
+		}
+	}
+}
+
+func TestTemplatePatchInvalidKey(t *testing.T) {
+	input := "server {\nport 80\n}\npatches!patch {\nserver[.port 8080\n}\n"
+
+	_, err := NewTemplateEngine().ProcessTemplateFromReader(strings.NewReader(input))
+	if err == nil || !strings.Contains(err.Error(), "invalid patch key") {
+		t.Errorf("Expected invalid patch key error, got %v", err)
+	}
+}
@@ -0,0 +1,601 @@
+package up
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema describes the expected shape of a UP document. Schemas are written
+// in UP: every top-level node declares a field, either with a type name
+// shorthand or with a block of constraints.
+//
+//	!schema {
+//	  additional false
+//	}
+//	name string
+//	port!int {
+//	  min 1
+//	  max 65535
+//	  default 8080
+//	}
+//	mode {
+//	  type string
+//	  enum [dev, prod]
+//	}
+//	server {
+//	  fields {
+//	    host string
+//	    tls!bool {
+//	      required false
+//	    }
+//	  }
+//	}
+//	tags {
+//	  items string
+//	}
+//	hosts {
+//	  columns {
+//	    name string
+//	    port int
+//	  }
+//	}
+//
+// Constraint blocks accept the keywords type, required, default, enum, min,
+// max, pattern, description, fields, additional, items and columns. A type
+// annotation on the field key is equivalent to a type keyword. Fields are
+// required unless they set required false or declare a default. Undeclared
+// keys are violations unless the enclosing block sets additional true; the
+// !schema directive does the same for top-level keys.
+type Schema struct {
+	Fields     []*Field // Top-level fields in declaration order
+	Additional bool     // Allow undeclared top-level keys
+}
+
+// Field describes the constraints on a key, a list item or a table column.
+type Field struct {
+	Name        string
+	Type        string   // string, int, float, bool, block, list, table or any
+	Required    bool     // The key must be present
+	Default     Value    // Value filled in by ApplyDefaults, or nil
+	Enum        []string // Allowed scalar values
+	Min         *float64 // Lower bound on numbers, or on the length of strings, lists and tables
+	Max         *float64 // Upper bound, with the same meaning as Min
+	Pattern     string   // Regular expression scalar values must match
+	Description string   // Free-form documentation
+	Fields      []*Field // Entries of a block, sorted by name when parsed
+	Additional  bool     // Allow undeclared block entries or table columns
+	Items       *Field   // Schema of list items
+	Columns     []*Field // Table columns, matched by name
+
+	pattern *regexp.Regexp
+	samples map[string]int // observed values and their counts, used by InferSchema
+}
+
+// schemaTypes maps accepted type names to their canonical form.
+var schemaTypes = map[string]string{
+	"string":  "string",
+	"int":     "int",
+	"integer": "int",
+	"float":   "float",
+	"number":  "float",
+	"bool":    "bool",
+	"boolean": "bool",
+	"block":   "block",
+	"list":    "list",
+	"table":   "table",
+	"any":     "any",
+}
+
+// kind returns the canonical type of the field. An empty Type is inferred
+// from Fields, Items or Columns and defaults to any.
+func (f *Field) kind() string {
+	if t, ok := schemaTypes[f.Type]; ok {
+		return t
+	}
+	switch {
+	case f.Fields != nil:
+		return "block"
+	case f.Items != nil:
+		return "list"
+	case f.Columns != nil:
+		return "table"
+	}
+	return "any"
+}
+
+// regexp returns the compiled pattern of the field, or nil if it has none.
+// NewSchema compiles patterns up front. A pattern set or changed afterwards
+// is compiled on every call rather than cached, so that concurrent
+// validations never write to the field.
+func (f *Field) regexp() (*regexp.Regexp, error) {
+	if f.Pattern == "" {
+		return nil, nil
+	}
+	if f.pattern != nil && f.pattern.String() == f.Pattern {
+		return f.pattern, nil
+	}
+	return regexp.Compile(f.Pattern)
+}
+
+// ParseSchema reads a schema written in UP.
+func ParseSchema(r io.Reader) (*Schema, error) {
+	p := NewParser()
+	p.RegisterDirective("schema", func(scanner *Scanner, args string) (Value, error) {
+		if args != "{" {
+			return nil, fmt.Errorf("!schema directive requires a block: !schema { ... }")
+		}
+		return p.ParseBlock(scanner)
+	})
+	doc, err := p.ParseDocument(r)
+	if err != nil {
+		return nil, err
+	}
+	return NewSchema(doc)
+}
+
+// NewSchema builds a schema from a parsed schema document.
+func NewSchema(doc *Document) (*Schema, error) {
+	schema := &Schema{Fields: make([]*Field, 0, len(doc.Nodes))}
+
+	if dir, ok := doc.Directive("schema"); ok {
+		block, _ := asMap(dir.Value)
+		for _, c := range mapChildren(block) {
+			if c.elem.Key != "additional" {
+				return nil, fmt.Errorf("!schema: unknown option %q", c.elem.Key)
+			}
+			additional, err := parseBool(fmt.Sprint(c.value))
+			if err != nil {
+				return nil, fmt.Errorf("!schema: additional: %w", err)
+			}
+			schema.Additional = additional
+		}
+	}
+
+	for _, node := range doc.Nodes {
+		f, err := parseField(doc, Path{{Key: node.Key}}, node.Key, node.Value)
+		if err != nil {
+			return nil, err
+		}
+		schema.Fields = append(schema.Fields, f)
+	}
+	return schema, nil
+}
+
+// parseField parses the declaration of a field located at path in a
+// schema document.
+func parseField(doc *Document, path Path, name string, value Value) (*Field, error) {
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%s: %s: %s", doc.position(path), path, fmt.Sprintf(format, args...))
+	}
+
+	f := &Field{Name: name, Type: doc.annotation(path), Required: true}
+
+	if s, ok := value.(string); ok {
+		if s != "" {
+			f.Type = s
+		}
+		if _, ok := schemaTypes[f.Type]; !ok && f.Type != "" {
+			return nil, fail("unknown type %q", f.Type)
+		}
+		return f, nil
+	}
+
+	block, ok := asMap(value)
+	if !ok {
+		return nil, fail("expected a type name or a block of constraints")
+	}
+
+	explicitRequired := false
+	for _, c := range mapChildren(block) {
+		p := path.Key(c.elem.Key)
+		text, _ := c.value.(string)
+
+		switch c.elem.Key {
+		case "type":
+			f.Type = text
+		case "required":
+			required, err := parseBool(text)
+			if err != nil {
+				return nil, fail("required: %v", err)
+			}
+			f.Required = required
+			explicitRequired = true
+		case "default":
+			f.Default = cloneValue(c.value)
+		case "enum":
+			items, ok := asList(c.value)
+			if !ok {
+				return nil, fail("enum must be a list")
+			}
+			for _, item := range items {
+				f.Enum = append(f.Enum, fmt.Sprint(item))
+			}
+		case "min", "max":
+			bound, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fail("%s must be a number, got %q", c.elem.Key, text)
+			}
+			if c.elem.Key == "min" {
+				f.Min = &bound
+			} else {
+				f.Max = &bound
+			}
+		case "pattern":
+			re, err := regexp.Compile(text)
+			if err != nil {
+				return nil, fail("invalid pattern: %v", err)
+			}
+			f.Pattern, f.pattern = text, re
+		case "description":
+			f.Description = text
+		case "additional":
+			additional, err := parseBool(text)
+			if err != nil {
+				return nil, fail("additional: %v", err)
+			}
+			f.Additional = additional
+		case "fields", "columns":
+			entries, ok := asMap(c.value)
+			if !ok {
+				return nil, fail("%s must be a block", c.elem.Key)
+			}
+			fields := make([]*Field, 0, len(entries))
+			for _, e := range mapChildren(entries) {
+				child, err := parseField(doc, p.Key(e.elem.Key), e.elem.Key, e.value)
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, child)
+			}
+			if c.elem.Key == "fields" {
+				f.Fields = fields
+			} else {
+				f.Columns = fields
+			}
+		case "items":
+			items, err := parseField(doc, p, "", c.value)
+			if err != nil {
+				return nil, err
+			}
+			f.Items = items
+		default:
+			return nil, fail("unknown schema keyword %q", c.elem.Key)
+		}
+	}
+
+	if _, ok := schemaTypes[f.Type]; !ok && f.Type != "" {
+		return nil, fail("unknown type %q", f.Type)
+	}
+	if f.Default != nil && !explicitRequired {
+		f.Required = false
+	}
+	return f, nil
+}
+
+// Violation is a single schema violation.
+type Violation struct {
+	Path     Path     // Location of the offending value
+	Position Position // Source position of the value or its nearest ancestor
+	Message  string
+}
+
+// String renders the violation as "line:column: path: message".
+func (v Violation) String() string {
+	if v.Position.IsValid() {
+		return fmt.Sprintf("%s: %s: %s", v.Position, displayPath(v.Path), v.Message)
+	}
+	return fmt.Sprintf("%s: %s", displayPath(v.Path), v.Message)
+}
+
+// Violations is the list of violations reported by Validate.
+type Violations []Violation
+
+// String renders the violations as text, one per line.
+func (vs Violations) String() string {
+	var sb strings.Builder
+	for _, v := range vs {
+		sb.WriteString(v.String())
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// Validate checks the document against the schema and returns every
+// violation, ordered by source position. A nil result means the document
+// is valid.
+func Validate(doc *Document, schema *Schema) Violations {
+	v := &validator{doc: doc}
+
+	declared := make(map[string]bool, len(schema.Fields))
+	for _, f := range schema.Fields {
+		declared[f.Name] = true
+		path := Path{{Key: f.Name}}
+		value, ok := lookupPath(doc, path)
+		if !ok {
+			if f.Required {
+				v.report(path, "missing required key")
+			}
+			continue
+		}
+		v.validateValue(path, f, value)
+	}
+
+	if !schema.Additional {
+		for _, node := range doc.Nodes {
+			if !declared[node.Key] {
+				v.report(Path{{Key: node.Key}}, "unknown key")
+				declared[node.Key] = true
+			}
+		}
+	}
+
+	sort.SliceStable(v.violations, func(i, j int) bool {
+		a, b := v.violations[i].Position, v.violations[j].Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return v.violations
+}
+
+// validator accumulates violations while validating a document.
+type validator struct {
+	doc        *Document
+	violations Violations
+}
+
+// report records a violation at path.
+func (v *validator) report(path Path, format string, args ...any) {
+	v.violations = append(v.violations, Violation{
+		Path:     path,
+		Position: v.doc.position(path),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// validateValue checks a value located at path against f.
+func (v *validator) validateValue(path Path, f *Field, value Value) {
+	switch kind := f.kind(); kind {
+	case "string", "int", "float", "bool":
+		s, ok := value.(string)
+		if !ok {
+			v.report(path, "expected %s, got %s", kind, describeValue(value))
+			return
+		}
+		v.validateScalar(path, f, kind, s)
+	case "block":
+		block, ok := asMap(value)
+		if !ok || v.doc.annotation(path) == "table" {
+			v.report(path, "expected block, got %s", describeValue(value))
+			return
+		}
+		v.validateBlock(path, f, block)
+	case "list":
+		list, ok := asList(value)
+		if !ok {
+			v.report(path, "expected list, got %s", describeValue(value))
+			return
+		}
+		v.validateLength(path, f, len(list), "items")
+		if f.Items != nil {
+			for i, item := range list {
+				v.validateValue(path.Index(i), f.Items, item)
+			}
+		}
+	case "table":
+		if !isTableValue(v.doc, path, value) {
+			v.report(path, "expected table, got %s", describeValue(value))
+			return
+		}
+		v.validateTable(path, f, value)
+	default:
+		if s, ok := value.(string); ok {
+			v.validateScalar(path, f, kind, s)
+		}
+	}
+}
+
+// validateScalar checks the type, enum, bounds and pattern of a scalar.
+func (v *validator) validateScalar(path Path, f *Field, kind, s string) {
+	switch kind {
+	case "int":
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			v.report(path, "expected int, got %q", s)
+			return
+		}
+		v.validateBounds(path, f, float64(n), s)
+	case "float":
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			v.report(path, "expected float, got %q", s)
+			return
+		}
+		v.validateBounds(path, f, n, s)
+	case "bool":
+		if _, err := parseBool(s); err != nil {
+			v.report(path, "expected bool, got %q", s)
+			return
+		}
+	case "string":
+		v.validateLength(path, f, utf8.RuneCountInString(s), "characters")
+	}
+
+	if len(f.Enum) > 0 && !containsString(f.Enum, s) {
+		v.report(path, "%q is not one of [%s]", s, strings.Join(f.Enum, ", "))
+	}
+	re, err := f.regexp()
+	if err != nil {
+		v.report(path, "invalid pattern %q: %v", f.Pattern, err)
+	} else if re != nil && !re.MatchString(s) {
+		v.report(path, "%q does not match pattern %q", s, f.Pattern)
+	}
+}
+
+// validateBounds checks a number against the field's min and max.
+func (v *validator) validateBounds(path Path, f *Field, n float64, s string) {
+	if f.Min != nil && n < *f.Min {
+		v.report(path, "%s is less than the minimum %s", s, formatBound(*f.Min))
+	}
+	if f.Max != nil && n > *f.Max {
+		v.report(path, "%s is greater than the maximum %s", s, formatBound(*f.Max))
+	}
+}
+
+// validateLength checks a length against the field's min and max.
+func (v *validator) validateLength(path Path, f *Field, n int, unit string) {
+	if f.Min != nil && float64(n) < *f.Min {
+		v.report(path, "has %d %s, expected at least %s", n, unit, formatBound(*f.Min))
+	}
+	if f.Max != nil && float64(n) > *f.Max {
+		v.report(path, "has %d %s, expected at most %s", n, unit, formatBound(*f.Max))
+	}
+}
+
+// validateBlock checks the entries of a block against f.Fields.
+func (v *validator) validateBlock(path Path, f *Field, block Block) {
+	declared := make(map[string]bool, len(f.Fields))
+	for _, child := range f.Fields {
+		declared[child.Name] = true
+		p := path.Key(child.Name)
+		value, ok := block[child.Name]
+		if !ok {
+			if child.Required {
+				v.report(p, "missing required key")
+			}
+			continue
+		}
+		v.validateValue(p, child, value)
+	}
+
+	if f.Additional || f.Fields == nil {
+		return
+	}
+	for _, c := range mapChildren(block) {
+		if !declared[c.elem.Key] {
+			v.report(path.Key(c.elem.Key), "unknown key")
+		}
+	}
+}
+
+// validateTable checks the columns and cells of a table against f.Columns.
+func (v *validator) validateTable(path Path, f *Field, value Value) {
+	table, _ := asMap(value)
+	columns, _ := asList(table["columns"])
+	rows, _ := asList(table["rows"])
+	v.validateLength(path, f, len(rows), "rows")
+	if f.Columns == nil {
+		return
+	}
+
+	byName := make(map[string]*Field, len(f.Columns))
+	for _, col := range f.Columns {
+		byName[col.Name] = col
+	}
+	present := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		name := fmt.Sprint(col)
+		present[name] = true
+		if byName[name] == nil && !f.Additional {
+			v.report(path.Key("columns"), "unknown column %q", name)
+		}
+	}
+	for _, col := range f.Columns {
+		if col.Required && !present[col.Name] {
+			v.report(path.Key("columns"), "missing required column %q", col.Name)
+		}
+	}
+
+	for r, row := range rows {
+		cells, _ := asList(row)
+		rowPath := path.Key("rows").Index(r)
+		for i, cell := range cells {
+			if i >= len(columns) {
+				v.report(rowPath, "has %d cells but the table has %d columns", len(cells), len(columns))
+				break
+			}
+			if col := byName[fmt.Sprint(columns[i])]; col != nil {
+				v.validateValue(rowPath.Index(i), col, cell)
+			}
+		}
+	}
+}
+
+// ApplyDefaults fills in missing fields that declare a default, descending
+// into blocks that are present in the document. Scalar defaults of a typed
+// field are annotated with the field type.
+func (s *Schema) ApplyDefaults(doc *Document) error {
+	return applyDefaults(doc, nil, s.Fields)
+}
+
+func applyDefaults(doc *Document, parent Path, fields []*Field) error {
+	for _, f := range fields {
+		path := parent.Key(f.Name)
+		value, ok := lookupPath(doc, path)
+		if !ok {
+			if f.Default == nil {
+				continue
+			}
+			if err := setPath(doc, path, cloneValue(f.Default), true); err != nil {
+				return err
+			}
+			if kind := f.kind(); kind != "any" && kind != "string" {
+				doc.setAnnotation(path, kind)
+			}
+			continue
+		}
+		if f.Fields != nil && isBlockLike(value) {
+			if err := applyDefaults(doc, path, f.Fields); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isTableValue reports whether the value at path is a parsed table.
+func isTableValue(doc *Document, path Path, value Value) bool {
+	m, ok := asMap(value)
+	if !ok {
+		return false
+	}
+	if doc.annotation(path) == "table" {
+		return true
+	}
+	_, hasColumns := m["columns"]
+	_, hasRows := m["rows"]
+	return hasColumns && hasRows && len(m) == 2
+}
+
+// describeValue names the shape of a value for error messages.
+func describeValue(v Value) string {
+	switch v.(type) {
+	case string:
+		return "scalar"
+	case Block, map[string]any:
+		return "block"
+	case List, []any:
+		return "list"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// formatBound formats a schema bound without a trailing fraction.
+func formatBound(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,232 @@
+package up
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testSchema = `name string
+port!int {
+  min 1
+  max 65535
+  default 8080
+}
+mode {
+  type string
+  enum [dev, prod]
+}
+server {
+  fields {
+    host {
+      type string
+      pattern ^[a-z.]+$
+    }
+    tls!bool {
+      required false
+    }
+  }
+}
+tags {
+  items string
+  min 1
+}
+hosts {
+  required false
+  columns {
+    name string
+    port int
+  }
+}
+`
+
+func TestParseSchema(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema() failed: %v", err)
+	}
+
+	if len(schema.Fields) != 6 {
+		t.Fatalf("Expected 6 fields, got %d", len(schema.Fields))
+	}
+
+	port := schema.Fields[1]
+	if port.Type != "int" || port.Required || port.Default != "8080" || *port.Min != 1 || *port.Max != 65535 {
+		t.Errorf("Unexpected port field: %+v", port)
+	}
+	if mode := schema.Fields[2]; strings.Join(mode.Enum, ",") != "dev,prod" || !mode.Required {
+		t.Errorf("Unexpected mode field: %+v", mode)
+	}
+	server := schema.Fields[3]
+	if len(server.Fields) != 2 || server.Fields[1].Name != "tls" || server.Fields[1].Type != "bool" {
+		t.Errorf("Unexpected server fields: %+v", server.Fields)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"port!int {\n  maximum 5\n}", `unknown schema keyword "maximum"`},
+		{"port uint", `unknown type "uint"`},
+		{"name {\n  pattern a(b\n}", "invalid pattern"},
+		{"!schema {\n  strict true\n}", `unknown option "strict"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseSchema(strings.NewReader(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseSchema(%q): expected error containing %q, got %v", tt.input, tt.want, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema() failed: %v", err)
+	}
+
+	valid := `name demo
+mode prod
+server {
+  host example.com
+}
+tags [a]
+hosts!table {
+  columns [name, port]
+  rows {
+    [web, 80]
+  }
+}
+`
+	doc, err := NewParser().ParseDocument(strings.NewReader(valid))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+	if violations := Validate(doc, schema); violations != nil {
+		t.Errorf("Expected no violations, got:\n%s", violations)
+	}
+
+	invalid := `port 70000
+mode staging
+server {
+  host Example.com
+  tls maybe
+  extra 1
+}
+tags []
+hosts!table {
+  columns [name, port]
+  rows {
+    [web, http]
+  }
+}
+debug true
+`
+	doc, err = NewParser().ParseDocument(strings.NewReader(invalid))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	expected := []string{
+		"name: missing required key",
+		"1:1: port: 70000 is greater than the maximum 65535",
+		`2:1: mode: "staging" is not one of [dev, prod]`,
+		`4:3: server.host: "Example.com" does not match pattern "^[a-z.]+$"`,
+		`5:3: server.tls: expected bool, got "maybe"`,
+		"6:3: server.extra: unknown key",
+		"8:1: tags: has 0 items, expected at least 1",
+		`9:1: hosts.rows[0][1]: expected int, got "http"`,
+		"15:1: debug: unknown key",
+	}
+	violations := Validate(doc, schema)
+	if len(violations) != len(expected) {
+		t.Fatalf("Expected %d violations, got %d:\n%s", len(expected), len(violations), violations)
+	}
+	for i, exp := range expected {
+		if got := violations[i].String(); got != exp {
+			t.Errorf("Violation %d: expected %q, got %q", i, exp, got)
+		}
+	}
+}
+
+func TestValidateConcurrent(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema() failed: %v", err)
+	}
+	// Fields built in Go have no compiled pattern yet
+	schema.Fields = append(schema.Fields, &Field{Name: "code", Type: "string", Pattern: "^[A-Z]+$"})
+	schema.Additional = true
+
+	doc, err := NewParser().ParseDocument(strings.NewReader("name demo\nserver {\n  host Example.com\n}\ncode abc\n"))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	counts := make([]int, 8)
+	for i := range counts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			counts[i] = len(Validate(doc, schema))
+		}(i)
+	}
+	wg.Wait()
+	for i, n := range counts {
+		if n != counts[0] || n == 0 {
+			t.Errorf("Validate() %d: got %d violations, first got %d", i, n, counts[0])
+		}
+	}
+}
+
+func TestSchemaApplyDefaults(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(testSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema() failed: %v", err)
+	}
+
+	doc, err := NewParser().ParseDocument(strings.NewReader("name demo\n"))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+	if err := schema.ApplyDefaults(doc); err != nil {
+		t.Fatalf("ApplyDefaults() failed: %v", err)
+	}
+
+	if v, _ := doc.Get("port"); v != "8080" || doc.Annotation("port") != "int" {
+		t.Errorf("Expected port!int 8080, got %v!%s", v, doc.Annotation("port"))
+	}
+}
+
+func TestDocumentPosition(t *testing.T) {
+	input := `name demo
+server {
+  host localhost
+  ports [
+    80
+    443
+  ]
+}
+`
+	doc, err := NewParser().ParseDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"name", "1:1"},
+		{"server.host", "3:3"},
+		{"server.ports[1]", "6:5"},
+		{"server.missing", "2:1"},
+		{"unknown", "-"},
+	}
+	for _, tt := range tests {
+		if got := doc.Position(tt.path).String(); got != tt.want {
+			t.Errorf("Position(%q): expected %s, got %s", tt.path, tt.want, got)
+		}
+	}
+}
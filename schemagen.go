@@ -0,0 +1,395 @@
+package up
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SchemaOf builds a schema from a Go struct type, reading the same `up`
+// tags as Unmarshal. v may be a struct, a pointer to a struct or a
+// reflect.Type. Fields tagged "required" are required and all others are
+// optional; fields tagged "-" and unexported fields are skipped. Nested
+// structs become blocks, slices and arrays become lists, maps with string
+// keys become blocks that accept any key and interfaces accept any value.
+// Types that decode themselves from text, such as time.Duration, are
+// strings. Untagged fields are keyed with NamingLower, like Unmarshal.
+func SchemaOf(v any) (*Schema, error) {
+	return SchemaOfNaming(v, NamingLower)
+}
+
+// SchemaOfNaming is like SchemaOf but keys untagged fields with the given
+// naming strategy, matching a Decoder configured with SetNaming.
+func SchemaOfNaming(v any, naming NamingStrategy) (*Schema, error) {
+	t, ok := v.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(v)
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema source must be a struct type, got %v", t)
+	}
+
+	g := &schemaGenerator{visiting: make(map[reflect.Type]bool), naming: naming}
+	fields, additional, err := g.structFields(nil, t)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{Fields: fields, Additional: additional}, nil
+}
+
+// schemaGenerator tracks the struct types being expanded so recursive
+// types terminate.
+type schemaGenerator struct {
+	visiting map[reflect.Type]bool
+	naming   NamingStrategy // key of untagged fields
+}
+
+// structFields returns the fields of struct type t in declaration order,
+// with the fields of inlined structs in place. It reports whether t has a
+// ",remain" field and so accepts additional keys.
+func (g *schemaGenerator) structFields(path Path, t reflect.Type) ([]*Field, bool, error) {
+	g.visiting[t] = true
+	defer delete(g.visiting, t)
+
+	fields := make([]*Field, 0, t.NumField())
+	additional := false
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("up")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+
+		if isInline(sf, name, opts) {
+			it := sf.Type
+			if it.Kind() == reflect.Ptr {
+				it = it.Elem()
+			}
+			if g.visiting[it] {
+				continue
+			}
+			inner, extra, err := g.structFields(path, it)
+			if err != nil {
+				return nil, false, err
+			}
+			fields = append(fields, inner...)
+			additional = additional || extra
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if hasOption(opts, "remain") {
+			additional = true
+			continue
+		}
+		if name == "" {
+			name = g.naming.key(sf.Name)
+		}
+
+		f, err := g.field(path.Key(name), name, sf.Type)
+		if err != nil {
+			return nil, false, err
+		}
+		f.Required = hasOption(opts, "required")
+		if text, ok := tagDefault(tag); ok {
+			if f.Default, err = tagValue(sf.Type, text); err != nil {
+				return nil, false, fmt.Errorf("%s: default: %v", path.Key(name), err)
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields, additional, nil
+}
+
+// field describes a value of Go type t located at path.
+func (g *schemaGenerator) field(path Path, name string, t reflect.Type) (*Field, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	f := &Field{Name: name}
+	if kind := customKind(t); kind != "" {
+		f.Type = kind
+		return f, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		f.Type = "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f.Type = "int"
+	case reflect.Float32, reflect.Float64:
+		f.Type = "float"
+	case reflect.Bool:
+		f.Type = "bool"
+	case reflect.Interface:
+		f.Type = "any"
+	case reflect.Struct:
+		f.Type = "block"
+		if g.visiting[t] {
+			f.Additional = true
+			break
+		}
+		fields, additional, err := g.structFields(path, t)
+		if err != nil {
+			return nil, err
+		}
+		f.Fields = fields
+		f.Additional = additional
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("%s: map keys must be strings, got %s", path, t.Key())
+		}
+		f.Type = "block"
+		f.Additional = true
+	case reflect.Slice, reflect.Array:
+		f.Type = "list"
+		items, err := g.field(path.Index(0), "", t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		items.Required = true
+		f.Items = items
+	default:
+		return nil, fmt.Errorf("%s: unsupported type %s", path, t)
+	}
+	return f, nil
+}
+
+// customKind returns the schema type of Go types that decode themselves:
+// any for Unmarshaler, string for built-in and text-encoded types, or ""
+// for other types.
+func customKind(t reflect.Type) string {
+	pt := reflect.PointerTo(t)
+	switch {
+	case pt.Implements(unmarshalerType):
+		return "any"
+	case t == durationType, t == timeType, t == urlType, pt.Implements(textUnmarshalerType):
+		return "string"
+	}
+	return ""
+}
+
+var (
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Document renders the schema as a UP document that ParseSchema accepts.
+func (s *Schema) Document() *Document {
+	doc := &Document{Nodes: make([]Node, 0, len(s.Fields))}
+	if s.Additional {
+		doc.Directives = []Directive{{Name: "schema", Value: Block{"additional": "true"}}}
+	}
+	for _, f := range s.Fields {
+		doc.Nodes = append(doc.Nodes, Node{Key: f.Name, Value: f.declaration(true)})
+	}
+	return doc
+}
+
+// declaration returns the schema syntax for the field: a type name when
+// it has no other constraints, otherwise a block of keywords. The required
+// keyword is only written for keyed fields; list items have no key.
+func (f *Field) declaration(keyed bool) Value {
+	block := make(Block)
+	implied := (&Field{Fields: f.Fields, Items: f.Items, Columns: f.Columns}).kind()
+	if f.Type != "" && f.Type != implied {
+		block["type"] = f.Type
+	}
+	if keyed {
+		switch {
+		case !f.Required && f.Default == nil:
+			block["required"] = "false"
+		case f.Required && f.Default != nil:
+			block["required"] = "true"
+		}
+	}
+	if f.Default != nil {
+		block["default"] = cloneValue(f.Default)
+	}
+	if len(f.Enum) > 0 {
+		enum := make([]any, len(f.Enum)) // written inline, as [a, b]
+		for i, e := range f.Enum {
+			enum[i] = e
+		}
+		block["enum"] = enum
+	}
+	if f.Min != nil {
+		block["min"] = formatBound(*f.Min)
+	}
+	if f.Max != nil {
+		block["max"] = formatBound(*f.Max)
+	}
+	if f.Pattern != "" {
+		block["pattern"] = f.Pattern
+	}
+	if f.Description != "" {
+		block["description"] = f.Description
+	}
+	if f.Additional {
+		block["additional"] = "true"
+	}
+	if f.Fields != nil {
+		fields := make(Block, len(f.Fields))
+		for _, child := range f.Fields {
+			fields[child.Name] = child.declaration(true)
+		}
+		block["fields"] = fields
+	}
+	if f.Columns != nil {
+		columns := make(Block, len(f.Columns))
+		for _, col := range f.Columns {
+			columns[col.Name] = col.declaration(true)
+		}
+		block["columns"] = columns
+	}
+	if f.Items != nil {
+		block["items"] = f.Items.declaration(false)
+	}
+
+	if t, ok := block["type"]; ok && len(block) == 1 {
+		return t
+	}
+	if len(block) == 0 {
+		return f.kind()
+	}
+	return block
+}
+
+// Example renders a commented example document for the schema. Each key is
+// preceded by a comment describing its type and constraints and holds its
+// default, its first enum value or an empty value of its type.
+func (s *Schema) Example() ([]byte, error) {
+	f := &formatter{doc: &Document{}}
+	for _, field := range s.Fields {
+		if err := writeExample(f, nil, field, 0); err != nil {
+			return nil, err
+		}
+	}
+	return f.buf.Bytes(), nil
+}
+
+// writeExample writes the comment and example entry for field at depth.
+func writeExample(f *formatter, parent Path, field *Field, depth int) error {
+	indent := strings.Repeat(indentUnit, depth)
+	path := parent.Key(field.Name)
+	if field.Description != "" {
+		for _, line := range strings.Split(field.Description, "\n") {
+			f.buf.WriteString(indent + "# " + line + "\n")
+		}
+	}
+	f.buf.WriteString(indent + "# " + field.summary() + "\n")
+
+	kind := field.kind()
+	if field.Default != nil {
+		return f.writeEntry(path, field.Name, exampleAnnotation(kind), field.Default, depth)
+	}
+
+	switch kind {
+	case "block":
+		f.buf.WriteString(indent + field.Name + " {\n")
+		for _, child := range field.Fields {
+			if err := writeExample(f, path, child, depth+1); err != nil {
+				return err
+			}
+		}
+		f.buf.WriteString(indent + "}\n")
+	case "list":
+		f.buf.WriteString(indent + field.Name + " [\n")
+		if items := field.Items; items != nil && items.kind() == "block" && items.Fields != nil {
+			itemIndent := indent + indentUnit
+			f.buf.WriteString(itemIndent + "{\n")
+			for _, child := range items.Fields {
+				if err := writeExample(f, path.Index(0), child, depth+2); err != nil {
+					return err
+				}
+			}
+			f.buf.WriteString(itemIndent + "}\n")
+		}
+		f.buf.WriteString(indent + "]\n")
+	case "table":
+		names := make([]string, len(field.Columns))
+		for i, col := range field.Columns {
+			names[i] = col.Name
+		}
+		f.buf.WriteString(indent + field.Name + "!table {\n")
+		f.buf.WriteString(indent + indentUnit + "columns [" + strings.Join(names, ", ") + "]\n")
+		f.buf.WriteString(indent + indentUnit + "rows {\n")
+		f.buf.WriteString(indent + indentUnit + "}\n")
+		f.buf.WriteString(indent + "}\n")
+	default:
+		return f.writeEntry(path, field.Name, exampleAnnotation(kind), exampleScalar(field, kind), depth)
+	}
+	return nil
+}
+
+// summary describes the type and constraints of the field on one line.
+func (f *Field) summary() string {
+	kind := f.kind()
+	parts := []string{kind}
+	switch {
+	case kind == "list" && f.Items != nil:
+		parts[0] = "list of " + f.Items.kind()
+	case kind == "table" && f.Columns != nil:
+		columns := make([]string, len(f.Columns))
+		for i, col := range f.Columns {
+			columns[i] = col.Name + " " + col.kind()
+		}
+		parts[0] = "table with columns " + strings.Join(columns, ", ")
+	}
+
+	if f.Required {
+		parts = append(parts, "required")
+	} else {
+		parts = append(parts, "optional")
+	}
+	if s, ok := f.Default.(string); ok {
+		parts = append(parts, fmt.Sprintf("default %q", s))
+	}
+	if len(f.Enum) > 0 {
+		parts = append(parts, "one of ["+strings.Join(f.Enum, ", ")+"]")
+	}
+	if f.Min != nil {
+		parts = append(parts, "min "+formatBound(*f.Min))
+	}
+	if f.Max != nil {
+		parts = append(parts, "max "+formatBound(*f.Max))
+	}
+	if f.Pattern != "" {
+		parts = append(parts, "pattern "+f.Pattern)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// exampleAnnotation returns the type annotation written for an example
+// scalar of the given kind.
+func exampleAnnotation(kind string) string {
+	switch kind {
+	case "int", "float", "bool":
+		return kind
+	}
+	return ""
+}
+
+// exampleScalar returns the example value of a scalar field.
+func exampleScalar(f *Field, kind string) string {
+	if len(f.Enum) > 0 {
+		return f.Enum[0]
+	}
+	switch kind {
+	case "int", "float":
+		if f.Min != nil {
+			return formatBound(*f.Min)
+		}
+		return "0"
+	case "bool":
+		return "false"
+	}
+	return ""
+}
@@ -0,0 +1,193 @@
+package up
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaTestConfig struct {
+	Name     string            `up:"name,required"`
+	Port     int               `up:"port"`
+	Ratio    *float64          `up:"ratio,omitempty"`
+	Tags     []string          `up:"tags"`
+	Labels   map[string]string `up:"labels"`
+	Internal string            `up:"-"`
+	Server   struct {
+		Host  string `up:"host,required"`
+		Debug bool
+	} `up:"server"`
+	Routes []struct {
+		Path string `up:"path,required"`
+	} `up:"routes"`
+
+	secret string
+}
+
+func TestSchemaOf(t *testing.T) {
+	schema, err := SchemaOf(&schemaTestConfig{})
+	if err != nil {
+		t.Fatalf("SchemaOf() failed: %v", err)
+	}
+
+	out, err := Format(schema.Document())
+	if err != nil {
+		t.Fatalf("Format() failed: %v", err)
+	}
+	expected := `name string
+port {
+  required false
+  type int
+}
+ratio {
+  required false
+  type float
+}
+tags {
+  items string
+  required false
+}
+labels {
+  additional true
+  required false
+  type block
+}
+server {
+  fields {
+    debug {
+      required false
+      type bool
+    }
+    host string
+  }
+  required false
+}
+routes {
+  items {
+    fields {
+      path string
+    }
+  }
+  required false
+}
+`
+	if string(out) != expected {
+		t.Errorf("Schema mismatch:\nexpected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	parsed, err := ParseSchema(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("ParseSchema() failed: %v", err)
+	}
+	again, _ := Format(parsed.Document())
+	if string(again) != string(out) {
+		t.Errorf("Schema did not round-trip:\n%s", again)
+	}
+
+	if _, err := SchemaOf(42); err == nil {
+		t.Error("Expected error for non-struct type")
+	}
+	if _, err := SchemaOf(struct{ C chan int }{}); err == nil || !strings.Contains(err.Error(), "c: unsupported type") {
+		t.Errorf("Expected unsupported type error, got %v", err)
+	}
+}
+
+func TestSchemaExample(t *testing.T) {
+	schema, err := SchemaOf(schemaTestConfig{})
+	if err != nil {
+		t.Fatalf("SchemaOf() failed: %v", err)
+	}
+	schema.Fields[1].Default = "8080"
+	schema.Fields[1].Description = "Port to listen on"
+
+	example, err := schema.Example()
+	if err != nil {
+		t.Fatalf("Example() failed: %v", err)
+	}
+	expected := `# string, required
+name
+# Port to listen on
+# int, optional, default "8080"
+port!int 8080
+# float, optional
+ratio!float 0
+# list of string, optional
+tags [
+]
+# block, optional
+labels {
+}
+# block, optional
+server {
+  # string, required
+  host
+  # bool, optional
+  debug!bool false
+}
+# list of block, optional
+routes [
+  {
+    # string, required
+    path
+  }
+]
+`
+	if string(example) != expected {
+		t.Errorf("Example mismatch:\nexpected:\n%s\ngot:\n%s", expected, example)
+	}
+
+	doc, err := NewParser().ParseDocument(bytes.NewReader(example))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+	if violations := Validate(doc, schema); violations != nil {
+		t.Errorf("Example does not validate:\n%s", violations)
+	}
+
+	var cfg schemaTestConfig
+	if err := UnmarshalDocument(doc, &cfg); err != nil {
+		t.Fatalf("UnmarshalDocument() failed: %v", err)
+	}
+	if cfg.Port != 8080 {
+		t.Errorf("Expected port 8080, got %d", cfg.Port)
+	}
+}
+
+func TestSchemaOf_TextTypes(t *testing.T) {
+	schema, err := SchemaOf(struct {
+		Timeout time.Duration
+		Size    ByteSize
+		Level   testLevel
+	}{})
+	if err != nil {
+		t.Fatalf("SchemaOf() failed: %v", err)
+	}
+	for i, want := range []string{"string", "string", "any"} {
+		if got := schema.Fields[i].Type; got != want {
+			t.Errorf("Field %s: expected type %s, got %s", schema.Fields[i].Name, want, got)
+		}
+	}
+}
+
+func TestSchemaOfNaming(t *testing.T) {
+	type config struct {
+		MaxConns int
+		HTTPHost string `up:"host"`
+	}
+	schema, err := SchemaOfNaming(config{}, NamingSnake)
+	if err != nil {
+		t.Fatalf("SchemaOfNaming() failed: %v", err)
+	}
+	if schema.Fields[0].Name != "max_conns" || schema.Fields[1].Name != "host" {
+		t.Errorf("Expected keys max_conns and host, got %s and %s", schema.Fields[0].Name, schema.Fields[1].Name)
+	}
+
+	doc, err := NewParser().ParseDocument(strings.NewReader("max_conns 10\nhost example.com\n"))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+	if violations := Validate(doc, schema); len(violations) != 0 {
+		t.Errorf("Expected no violations, got %v", violations)
+	}
+}
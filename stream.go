@@ -0,0 +1,135 @@
+package up
+
+import (
+	"io"
+)
+
+// Decoder reads a UP document from an input stream and decodes it into Go
+// values. UP has no document separator, so a stream holds exactly one
+// document: the first call to Decode reads until io.EOF and builds the
+// whole Document before decoding it, which blocks on a connection that
+// stays open. Later calls return io.EOF.
+type Decoder struct {
+	r      io.Reader
+	parser *Parser
+	state  decodeState
+	done   bool
+}
+
+// NewDecoder returns a decoder that reads from r using a default Parser.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, parser: NewParser()}
+}
+
+// SetParser replaces the parser used to read the stream, for example one
+// with custom directives registered.
+func (dec *Decoder) SetParser(p *Parser) {
+	dec.parser = p
+}
+
+// DisallowUnknownFields causes Decode to return an error when the document
+// contains keys, at any depth, that do not match a field of the
+// destination struct; see UnmarshalDocumentStrict.
+func (dec *Decoder) DisallowUnknownFields() {
+	dec.state.disallowUnknownFields = true
+}
+
+// CollectErrors causes Decode to keep going after a value cannot be
+// decoded and to return every *UnmarshalError, joined into one error.
+func (dec *Decoder) CollectErrors() {
+	dec.state.collectErrors = true
+}
+
+// ValidateStructs causes Decode to check the decoded value with
+// ValidateStruct, using the validate tags of its fields and the Validate
+// methods of its values. Violations are reported at their position in the
+// document, in a single *ValidationError.
+func (dec *Decoder) ValidateStructs() {
+	dec.state.validate = true
+}
+
+// SetNaming sets how untagged struct fields are matched to document keys.
+// The default, NamingLower, matches the lower-cased field name.
+func (dec *Decoder) SetNaming(n NamingStrategy) {
+	dec.state.naming = n
+}
+
+// Decode reads the rest of the stream as a single UP document and stores
+// it in v, which must be a pointer to a struct or a *Document. Once the
+// stream has been consumed, Decode returns io.EOF.
+func (dec *Decoder) Decode(v any) error {
+	if dec.done {
+		return io.EOF
+	}
+	dec.done = true
+
+	doc, err := dec.parser.ParseDocument(dec.r)
+	if err != nil {
+		return err
+	}
+	if target, ok := v.(*Document); ok {
+		*target = *doc
+		return nil
+	}
+	return dec.state.unmarshalDocument(doc, v)
+}
+
+// Sources reports where the fields set by the last call to Decode got their
+// values, keyed by the path of the field in the document, such as
+// "server.port". Fields that were not set are absent.
+func (dec *Decoder) Sources() map[string]Source {
+	return dec.state.sources
+}
+
+// Encoder writes UP documents to an output stream.
+type Encoder struct {
+	w     io.Writer
+	state encodeState
+	unit  string
+}
+
+// NewEncoder returns an encoder that writes to w. Type annotations are
+// written and nested values are indented by two spaces.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w, state: encodeState{annotate: true}, unit: indentUnit}
+}
+
+// SetIndent sets the indentation written for each level of nesting. An
+// empty string selects the default of two spaces.
+func (enc *Encoder) SetIndent(indent string) {
+	enc.unit = indent
+}
+
+// SetAnnotations controls whether scalar type annotations such as !int
+// and !bool are written for Go values. Documents passed to Encode keep
+// their own annotations.
+func (enc *Encoder) SetAnnotations(on bool) {
+	enc.state.annotate = on
+}
+
+// SetNaming sets how the keys of untagged struct fields are derived from
+// their names. The default, NamingLower, writes the lower-cased name.
+func (enc *Encoder) SetNaming(n NamingStrategy) {
+	enc.state.naming = n
+}
+
+// Encode writes the UP encoding of v to the stream. v may be any value
+// accepted by Marshal, or a *Document, which is written as is. Nothing
+// separates the output of successive calls, so a Decoder reads them back
+// as a single document.
+func (enc *Encoder) Encode(v any) error {
+	doc, ok := v.(*Document)
+	if !ok {
+		var err error
+		if doc, err = enc.state.marshalDocument(v); err != nil {
+			return err
+		}
+	}
+
+	f := &formatter{doc: doc, unit: enc.unit}
+	if err := f.writeDocument(); err != nil {
+		return err
+	}
+	_, err := enc.w.Write(f.buf.Bytes())
+	return err
+}
@@ -0,0 +1,402 @@
+package up
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecoder(t *testing.T) {
+	type config struct {
+		Name   string `up:"name"`
+		Server struct {
+			Port int `up:"port"`
+		} `up:"server"`
+	}
+
+	input := "name demo\nserver {\n  port!int 8080\n}\n"
+	dec := NewDecoder(strings.NewReader(input))
+
+	var cfg config
+	if err := dec.Decode(&cfg); err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if cfg.Name != "demo" || cfg.Server.Port != 8080 {
+		t.Errorf("Unexpected result: %+v", cfg)
+	}
+	if err := dec.Decode(&cfg); err != io.EOF {
+		t.Errorf("Expected io.EOF on second Decode, got %v", err)
+	}
+
+	var doc Document
+	if err := NewDecoder(strings.NewReader(input)).Decode(&doc); err != nil {
+		t.Fatalf("Decode(*Document) failed: %v", err)
+	}
+	if v, _ := doc.Get("server.port"); v != "8080" {
+		t.Errorf("Expected server.port 8080, got %v", v)
+	}
+
+	strict := NewDecoder(strings.NewReader(input + "extra 1\n"))
+	strict.DisallowUnknownFields()
+	if err := strict.Decode(&cfg); err == nil || !strings.Contains(err.Error(), `unknown field "extra"`) {
+		t.Errorf("Expected unknown field error, got %v", err)
+	}
+
+	lenient := NewDecoder(strings.NewReader(input + "extra 1\n"))
+	if err := lenient.Decode(&cfg); err != nil {
+		t.Errorf("Expected unknown fields to be ignored, got %v", err)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	type config struct {
+		Name   string `up:"name"`
+		Server struct {
+			Port  int  `up:"port"`
+			Debug bool `up:"debug"`
+		} `up:"server"`
+	}
+	var cfg config
+	cfg.Name = "demo"
+	cfg.Server.Port = 8080
+
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetIndent("\t")
+	enc.SetAnnotations(false)
+	if err := enc.Encode(cfg); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+
+	expected := "name demo\nserver {\n\tdebug false\n\tport 8080\n}\n"
+	if buf.String() != expected {
+		t.Errorf("Encode() mismatch:\nexpected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	var decoded config
+	if err := NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if decoded != cfg {
+		t.Errorf("Round trip mismatch: expected %+v, got %+v", cfg, decoded)
+	}
+
+	buf.Reset()
+	if err := NewEncoder(&buf).Encode(cfg); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "  port!int 8080\n") {
+		t.Errorf("Expected annotated, space-indented output, got:\n%s", buf.String())
+	}
+}
+
+func TestNamingStrategy(t *testing.T) {
+	type config struct {
+		MaxConns   int
+		HTTPServer string
+		UserID     string
+		Name       string `up:"title"`
+	}
+
+	tests := []struct {
+		naming NamingStrategy
+		keys   []string
+	}{
+		{NamingLower, []string{"maxconns", "httpserver", "userid"}},
+		{NamingSnake, []string{"max_conns", "http_server", "user_id"}},
+		{NamingKebab, []string{"max-conns", "http-server", "user-id"}},
+		{NamingCamel, []string{"maxConns", "httpServer", "userId"}},
+		{NamingExact, []string{"MaxConns", "HTTPServer", "UserID"}},
+	}
+
+	for _, tt := range tests {
+		input := tt.keys[0] + "!int 10\n" + tt.keys[1] + " web\n" + tt.keys[2] + " u1\ntitle demo\n"
+		dec := NewDecoder(strings.NewReader(input))
+		dec.SetNaming(tt.naming)
+		dec.DisallowUnknownFields()
+
+		var cfg config
+		if err := dec.Decode(&cfg); err != nil {
+			t.Fatalf("naming %d: Decode() failed: %v", tt.naming, err)
+		}
+		if cfg.MaxConns != 10 || cfg.HTTPServer != "web" || cfg.UserID != "u1" || cfg.Name != "demo" {
+			t.Errorf("naming %d: unexpected result: %+v", tt.naming, cfg)
+		}
+
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		enc.SetNaming(tt.naming)
+		if err := enc.Encode(cfg); err != nil {
+			t.Fatalf("naming %d: Encode() failed: %v", tt.naming, err)
+		}
+		if buf.String() != input {
+			t.Errorf("naming %d: expected:\n%s\ngot:\n%s", tt.naming, input, buf.String())
+		}
+	}
+
+	dec := NewDecoder(strings.NewReader("MAXCONNS!int 3\nHttpServer web\n"))
+	dec.SetNaming(NamingCaseInsensitive)
+	dec.DisallowUnknownFields()
+	var cfg config
+	if err := dec.Decode(&cfg); err != nil {
+		t.Fatalf("case-insensitive Decode() failed: %v", err)
+	}
+	if cfg.MaxConns != 3 || cfg.HTTPServer != "web" {
+		t.Errorf("Unexpected case-insensitive result: %+v", cfg)
+	}
+}
+
+func TestDecoderDefaultsAndEnv(t *testing.T) {
+	type database struct {
+		Host    string `up:"host,default=localhost"`
+		Port    int    `up:"port,default=5432" env:"TEST_UP_DB_PORT"`
+		Timeout *int   `up:"timeout,default=30"`
+	}
+	type config struct {
+		Name     string    `up:"name,default=app"`
+		Hosts    []string  `up:"hosts,default=[a, b]"`
+		Level    string    `up:"level,default=info" env:"TEST_UP_LEVEL"`
+		Token    string    `up:"token,required" env:"TEST_UP_TOKEN"`
+		Database database  `up:"database"`
+		Replica  *database `up:"replica"`
+		Cache    *struct {
+			Size int `up:"size"`
+		} `up:"cache"`
+	}
+
+	t.Setenv("TEST_UP_LEVEL", "debug")
+	t.Setenv("TEST_UP_TOKEN", "secret")
+	t.Setenv("TEST_UP_DB_PORT", "6543")
+
+	dec := NewDecoder(strings.NewReader("name demo\nlevel warn\n"))
+	var cfg config
+	if err := dec.Decode(&cfg); err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	if cfg.Name != "demo" || cfg.Level != "debug" || cfg.Token != "secret" {
+		t.Errorf("Unexpected result: %+v", cfg)
+	}
+	if len(cfg.Hosts) != 2 || cfg.Hosts[1] != "b" {
+		t.Errorf("Expected default hosts [a b], got %v", cfg.Hosts)
+	}
+	if cfg.Database.Host != "localhost" || cfg.Database.Port != 6543 {
+		t.Errorf("Unexpected database: %+v", cfg.Database)
+	}
+	if cfg.Database.Timeout == nil || *cfg.Database.Timeout != 30 {
+		t.Errorf("Expected default timeout 30, got %v", cfg.Database.Timeout)
+	}
+	if cfg.Replica == nil || cfg.Replica.Host != "localhost" || cfg.Replica.Port != 6543 {
+		t.Errorf("Expected replica allocated with defaults and env, got %+v", cfg.Replica)
+	}
+	if cfg.Cache != nil {
+		t.Errorf("Expected nil cache without defaults, got %+v", cfg.Cache)
+	}
+
+	expected := map[string]Source{
+		"name":             SourceFile,
+		"hosts":            SourceDefault,
+		"level":            SourceEnv,
+		"token":            SourceEnv,
+		"database.host":    SourceDefault,
+		"database.port":    SourceEnv,
+		"database.timeout": SourceDefault,
+		"replica.host":     SourceDefault,
+		"replica.port":     SourceEnv,
+		"replica.timeout":  SourceDefault,
+	}
+	sources := dec.Sources()
+	for path, want := range expected {
+		if got := sources[path]; got != want {
+			t.Errorf("Expected source of %s to be %s, got %s", path, want, got)
+		}
+	}
+	if len(sources) != len(expected) {
+		t.Errorf("Expected %d sources, got %v", len(expected), sources)
+	}
+
+	bad := NewDecoder(strings.NewReader("token x\ndatabase {\n  port oops\n}\n"))
+	if err := bad.Decode(&cfg); err == nil {
+		t.Error("Expected error for invalid port")
+	}
+
+	schema, err := SchemaOf(database{})
+	if err != nil {
+		t.Fatalf("SchemaOf() failed: %v", err)
+	}
+	if schema.Fields[1].Default != "5432" {
+		t.Errorf("Expected schema default 5432, got %v", schema.Fields[1].Default)
+	}
+}
+
+func TestDecoderUnmarshalErrors(t *testing.T) {
+	type replica struct {
+		Port int `up:"port"`
+	}
+	type config struct {
+		Database struct {
+			Replicas []replica     `up:"replicas"`
+			Timeout  time.Duration `up:"timeout"`
+		} `up:"database"`
+		Limits map[string]int `up:"limits"`
+		Debug  bool           `up:"debug"`
+		Name   string         `up:"name,required"`
+	}
+
+	input := `database {
+  replicas [
+    {
+      port!int 5432
+    }
+    {
+      port fast
+    }
+  ]
+  timeout soon
+}
+limits {
+  cpu lots
+}
+debug maybe
+`
+	var cfg config
+	err := NewDecoder(strings.NewReader(input)).Decode(&cfg)
+	var uerr *UnmarshalError
+	if !errors.As(err, &uerr) {
+		t.Fatalf("Expected *UnmarshalError, got %v", err)
+	}
+	if uerr.Path != "database.replicas[1].port" || uerr.Field != "config.Database.Replicas[1].Port" ||
+		uerr.Position != (Position{Line: 7, Column: 7}) || uerr.Type != "int" || uerr.Value != "fast" {
+		t.Errorf("Unexpected error details: %+v", uerr)
+	}
+	if !strings.HasPrefix(err.Error(), "7:7: database.replicas[1].port: cannot parse as int") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+
+	dec := NewDecoder(strings.NewReader(input))
+	dec.CollectErrors()
+	err = dec.Decode(&cfg)
+	if err == nil {
+		t.Fatal("Expected errors")
+	}
+	expected := []string{
+		"7:7: database.replicas[1].port: ",
+		`10:3: database.timeout: invalid duration "soon"`,
+		"13:3: limits.cpu: cannot parse as int",
+		"15:1: debug: cannot parse as bool",
+		"name: required field not found",
+	}
+	lines := strings.Split(err.Error(), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d errors, got:\n%v", len(expected), err)
+	}
+	for i, want := range expected {
+		if !strings.HasPrefix(lines[i], want) {
+			t.Errorf("Error %d: expected prefix %q, got %q", i, want, lines[i])
+		}
+	}
+	if cfg.Database.Replicas[0].Port != 5432 {
+		t.Errorf("Expected valid values to be decoded, got %+v", cfg.Database.Replicas)
+	}
+
+	t.Setenv("TEST_UP_PORT", "high")
+	var envCfg struct {
+		Port int `up:"port" env:"TEST_UP_PORT"`
+	}
+	err = NewDecoder(strings.NewReader("port!int 1\n")).Decode(&envCfg)
+	if err == nil || err.Error() != `1:1: port: env TEST_UP_PORT: cannot parse as int: strconv.ParseInt: parsing "high": invalid syntax` {
+		t.Errorf("Unexpected env error: %v", err)
+	}
+}
+
+func TestNamingStrategyUnderscores(t *testing.T) {
+	type config struct {
+		A__B string
+	}
+
+	tests := []struct {
+		naming NamingStrategy
+		key    string
+	}{
+		{NamingLower, "a__b"},
+		{NamingSnake, "a_b"},
+		{NamingKebab, "a-b"},
+		{NamingCamel, "aB"},
+		{NamingExact, "A__B"},
+	}
+	for _, tt := range tests {
+		if got := tt.naming.key("A__B"); got != tt.key {
+			t.Errorf("naming %d: expected key %q, got %q", tt.naming, tt.key, got)
+		}
+
+		dec := NewDecoder(strings.NewReader(tt.key + " x\n"))
+		dec.SetNaming(tt.naming)
+		var cfg config
+		if err := dec.Decode(&cfg); err != nil {
+			t.Fatalf("naming %d: Decode() failed: %v", tt.naming, err)
+		}
+		if cfg.A__B != "x" {
+			t.Errorf("naming %d: expected A__B x, got %q", tt.naming, cfg.A__B)
+		}
+	}
+}
+
+type testChain struct {
+	Name string     `up:"name" env:"TEST_UP_CHAIN_NAME"`
+	Next *testChain `up:"next"`
+}
+
+func TestDecoderEnvOnMissingPointer(t *testing.T) {
+	type config struct {
+		TLS *struct {
+			Cert string `up:"cert" env:"TEST_UP_TLS_CERT"`
+		} `up:"tls"`
+		Chain *testChain `up:"chain"`
+	}
+
+	var cfg config
+	if err := NewDecoder(strings.NewReader("")).Decode(&cfg); err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if cfg.TLS != nil || cfg.Chain != nil {
+		t.Errorf("Expected nil pointers without env, got %+v", cfg)
+	}
+
+	t.Setenv("TEST_UP_TLS_CERT", "server.pem")
+	t.Setenv("TEST_UP_CHAIN_NAME", "head")
+	dec := NewDecoder(strings.NewReader(""))
+	if err := dec.Decode(&cfg); err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if cfg.TLS == nil || cfg.TLS.Cert != "server.pem" {
+		t.Errorf("Expected tls.cert from env, got %+v", cfg.TLS)
+	}
+	if cfg.Chain == nil || cfg.Chain.Name != "head" || cfg.Chain.Next != nil {
+		t.Errorf("Expected a single chain link from env, got %+v", cfg.Chain)
+	}
+	if dec.Sources()["tls.cert"] != SourceEnv {
+		t.Errorf("Expected tls.cert source env, got %v", dec.Sources())
+	}
+}
+
+func TestDecoderUnnamedDefault(t *testing.T) {
+	type config struct {
+		Port  int      `up:"default=8080"`
+		Hosts []string `up:"default=[a, b]"`
+	}
+
+	dec := NewDecoder(strings.NewReader("port!int 9090\n"))
+	var cfg config
+	if err := dec.Decode(&cfg); err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if cfg.Port != 9090 || len(cfg.Hosts) != 2 {
+		t.Errorf("Unexpected result: %+v", cfg)
+	}
+	if sources := dec.Sources(); sources["port"] != SourceFile || sources["hosts"] != SourceDefault || len(sources) != 2 {
+		t.Errorf("Unexpected sources: %v", sources)
+	}
+}
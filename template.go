@@ -212,7 +212,11 @@ func (e *TemplateEngine) processDocument(doc *Document) (*Document, error) {
 
 	// 5. Apply patches
 	if len(patchNodes) > 0 {
-		finalDoc = e.applyPatches(finalDoc, patchNodes)
+		patched, err := e.applyPatches(finalDoc, patchNodes)
+		if err != nil {
+			return nil, err
+		}
+		finalDoc = patched
 	}
 
 	// 6. Iteratively resolve variable references until convergence or circular dependency
@@ -221,9 +225,33 @@ func (e *TemplateEngine) processDocument(doc *Document) (*Document, error) {
 		return nil, err
 	}
 
+	// 7. Carry over document directives from every source, without duplicates
+	finalDoc.Directives = collectDirectives(append(allDocs, doc))
+
 	return finalDoc, nil
 }
 
+// collectDirectives returns the directives of all documents, skipping
+// directives equal to one already collected
+func collectDirectives(docs []*Document) []Directive {
+	var result []Directive
+	for _, d := range docs {
+		for _, dir := range d.Directives {
+			duplicate := false
+			for _, existing := range result {
+				if existing.Name == dir.Name && Equal(existing.Value, dir.Value) {
+					duplicate = true
+					break
+				}
+			}
+			if !duplicate {
+				result = append(result, dir)
+			}
+		}
+	}
+	return result
+}
+
 // loadDocumentRaw loads and parses a document without processing template directives
 func (e *TemplateEngine) loadDocumentRaw(filename string) (*Document, error) {
 	absPath, err := filepath.Abs(filename)
@@ -295,7 +323,7 @@ func (e *TemplateEngine) resolveVariablesIteratively(doc *Document) (*Document,
 			newVars[path] = resolved
 
 			// Check if this variable changed
-			if !valuesEqual(value, resolved) {
+			if !Equal(value, resolved) {
 				hasChanges = true
 			}
 		}
@@ -327,41 +355,6 @@ func (e *TemplateEngine) resolveVariablesIteratively(doc *Document) (*Document,
 	return result, nil
 }
 
-// valuesEqual checks if two values are equal (for detecting convergence)
-func valuesEqual(a, b any) bool {
-	switch va := a.(type) {
-	case string:
-		vb, ok := b.(string)
-		return ok && va == vb
-	case Block:
-		vb, ok := b.(Block)
-		if !ok || len(va) != len(vb) {
-			return false
-		}
-		for k, v := range va {
-			if !valuesEqual(v, vb[k]) {
-				return false
-			}
-		}
-		return true
-	case List:
-		vb, ok := b.(List)
-		if !ok || len(va) != len(vb) {
-			return false
-		}
-		for i, v := range va {
-			if !valuesEqual(v, vb[i]) {
-				return false
-			}
-		}
-		return true
-	case int, int64, float64, bool:
-		return a == b
-	default:
-		return false
-	}
-}
-
 // resolveValue resolves $vars references in a value
 func (e *TemplateEngine) resolveValue(value any) any {
 	switch v := value.(type) {
@@ -553,82 +546,42 @@ func (e *TemplateEngine) uniqueList(list List) List {
 	return result
 }
 
-// applyPatches applies patch directives to a document
-func (e *TemplateEngine) applyPatches(doc *Document, patches []Node) *Document {
+// applyPatches applies patch directives to a document.
+// Patch keys use query syntax (e.g., "server.host", "servers[*].cpu",
+// "servers[name=web].cpu"); patches whose path does not resolve are ignored,
+// while keys that are not valid queries are an error.
+func (e *TemplateEngine) applyPatches(doc *Document, patches []Node) (*Document, error) {
 	result := &Document{Nodes: make([]Node, len(doc.Nodes))}
 	copy(result.Nodes, doc.Nodes)
 
 	for _, patch := range patches {
-		// Parse patch path (e.g., "server.host", "servers[*].cpu")
-		parts := strings.Split(patch.Key, ".")
-		e.applyPatchPath(result, parts, patch.Value)
-	}
-
-	return result
-}
-
-// applyPatchPath applies a patch at a specific path
-func (e *TemplateEngine) applyPatchPath(doc *Document, path []string, value any) {
-	if len(path) == 0 {
-		return
-	}
-
-	// Find the target node
-	for i, node := range doc.Nodes {
-		if node.Key == path[0] {
-			if len(path) == 1 {
-				// Direct replacement
-				doc.Nodes[i].Value = value
-			} else {
-				// Navigate deeper
-				if block, ok := node.Value.(Block); ok {
-					e.applyPatchToBlock(block, path[1:], value)
-				}
-			}
-			return
+		q, err := CompileQuery(patch.Key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid patch key: %w", err)
 		}
-	}
-}
-
-// applyPatchToBlock applies a patch within a block
-func (e *TemplateEngine) applyPatchToBlock(block Block, path []string, value any) {
-	if len(path) == 0 {
-		return
+		e.applyPatchQuery(result, q, patch.Value)
 	}
 
-	key := path[0]
-
-	// Handle list indexing: key[*], key[0], key[name=value]
-	if strings.Contains(key, "[") {
-		// Extract base key and selector
-		parts := strings.SplitN(key, "[", 2)
-		baseKey := parts[0]
-		selector := strings.TrimSuffix(parts[1], "]")
+	return result, nil
+}
 
-		if list, ok := block[baseKey].(List); ok {
-			if selector == "*" {
-				// Apply to all items
-				for i := range list {
-					if len(path) == 1 {
-						list[i] = value
-					} else if itemBlock, ok := list[i].(Block); ok {
-						e.applyPatchToBlock(itemBlock, path[1:], value)
-					}
-				}
+// applyPatchQuery sets value at every location selected by q.
+// When the final step is a plain key, it is set on every matched parent
+// block, so patches can add keys that don't exist yet.
+func (e *TemplateEngine) applyPatchQuery(doc *Document, q *Query, value any) {
+	last := q.steps[len(q.steps)-1]
+	if len(q.steps) > 1 && last.kind == stepKey && !last.recursive {
+		parent := &Query{steps: q.steps[:len(q.steps)-1]}
+		for _, m := range parent.Select(doc) {
+			if isBlockLike(m.Value) {
+				_ = setPath(doc, m.Path.Key(last.key), value, false)
 			}
-			// Could add numeric index and key=value selectors here
 		}
 		return
 	}
 
-	if len(path) == 1 {
-		// Direct set
-		block[key] = value
-	} else {
-		// Navigate deeper
-		if nestedBlock, ok := block[key].(Block); ok {
-			e.applyPatchToBlock(nestedBlock, path[1:], value)
-		}
+	for _, m := range q.Select(doc) {
+		_ = setPath(doc, m.Path, value, false)
 	}
 }
 
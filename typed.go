@@ -0,0 +1,165 @@
+package up
+
+import (
+	"fmt"
+	"iter"
+
+	"github.com/uplang/go/value"
+)
+
+// ToValue converts an any-based value produced by the parser into the
+// sealed value model. Strings become value.String, inline and multi-line
+// lists both become value.List, and raw table maps become value.Table.
+// Only Document.Values knows which strings were written with ``` fences
+// and reports them as value.Multiline.
+func ToValue(v Value) value.Value {
+	return valueConverter{}.convert(nil, v)
+}
+
+// valueConverter converts values located at a path into the sealed value
+// model.
+type valueConverter struct {
+	multiline map[string]bool // paths of values written with ``` fences
+}
+
+// convert converts v located at path.
+func (c valueConverter) convert(path Path, v Value) value.Value {
+	switch v := v.(type) {
+	case string:
+		if len(c.multiline) > 0 && c.multiline[path.String()] {
+			return value.Multiline(v)
+		}
+		return value.String(v)
+	case Block:
+		return blockToValue(c, path, v)
+	case map[string]any:
+		if t, ok := tableToValue(v["columns"], v["rows"]); ok {
+			return t
+		}
+		return blockToValue(c, path, v)
+	case Table:
+		if t, ok := tableToValue(v.Columns, v.Rows); ok {
+			return t
+		}
+		return value.Table{}
+	case List:
+		return listToValue(c, path, v)
+	case []any:
+		return listToValue(c, path, v)
+	case UseDirective:
+		return value.Directive{Name: "use", Args: append([]string(nil), v.Namespaces...)}
+	case nil:
+		return value.String("")
+	default:
+		return value.String(fmt.Sprint(v))
+	}
+}
+
+// FromValue converts a sealed value back into the any-based model used by
+// the parser and the rest of this package.
+func FromValue(v value.Value) Value {
+	switch v := v.(type) {
+	case value.String:
+		return string(v)
+	case value.Multiline:
+		return string(v)
+	case value.Block:
+		result := make(Block, len(v))
+		for k, item := range v {
+			result[k] = FromValue(item)
+		}
+		return result
+	case value.List:
+		result := make(List, len(v))
+		for i, item := range v {
+			result[i] = FromValue(item)
+		}
+		return result
+	case value.Table:
+		columns := make([]any, len(v.Columns))
+		for i, c := range v.Columns {
+			columns[i] = c
+		}
+		rows := make([]any, len(v.Rows))
+		for i, row := range v.Rows {
+			cells := make([]any, len(row))
+			for j, cell := range row {
+				cells[j] = FromValue(cell)
+			}
+			rows[i] = cells
+		}
+		return map[string]any{"columns": columns, "rows": rows}
+	case value.Directive:
+		if v.Name == "use" {
+			return UseDirective{Namespaces: append([]string(nil), v.Args...)}
+		}
+		return FromValue(v.Body)
+	default:
+		return nil
+	}
+}
+
+// Values returns an iterator over the top-level keys of the document and
+// their values in the sealed value model.
+func (d *Document) Values() iter.Seq2[string, value.Value] {
+	c := valueConverter{multiline: d.multiline}
+	return func(yield func(string, value.Value) bool) {
+		for _, node := range d.Nodes {
+			if !yield(node.Key, c.convert(Path{{Key: node.Key}}, node.Value)) {
+				return
+			}
+		}
+	}
+}
+
+// ToValue converts the directive into the sealed value model.
+func (dir Directive) ToValue() value.Directive {
+	switch v := dir.Value.(type) {
+	case UseDirective:
+		return value.Directive{Name: dir.Name, Args: append([]string(nil), v.Namespaces...)}
+	case Block:
+		return value.Directive{Name: dir.Name, Body: blockToValue(valueConverter{}, nil, v)}
+	default:
+		if dir.Value == nil {
+			return value.Directive{Name: dir.Name}
+		}
+		return value.Directive{Name: dir.Name, Body: value.Block{"value": ToValue(dir.Value)}}
+	}
+}
+
+func blockToValue[M ~map[string]V, V any](c valueConverter, path Path, m M) value.Block {
+	result := make(value.Block, len(m))
+	for k, item := range m {
+		result[k] = c.convert(path.Key(k), item)
+	}
+	return result
+}
+
+func listToValue[L ~[]V, V any](c valueConverter, path Path, l L) value.List {
+	result := make(value.List, len(l))
+	for i, item := range l {
+		result[i] = c.convert(path.Index(i), item)
+	}
+	return result
+}
+
+// tableToValue converts parsed table columns and rows.
+func tableToValue(columns, rows any) (value.Table, bool) {
+	cols, ok := asList(columns)
+	if !ok {
+		return value.Table{}, false
+	}
+	t := value.Table{Columns: make([]string, len(cols))}
+	for i, c := range cols {
+		t.Columns[i] = fmt.Sprint(c)
+	}
+	rowList, _ := asList(rows)
+	for _, row := range rowList {
+		cells, ok := asList(row)
+		if !ok {
+			return value.Table{}, false
+		}
+		t.Rows = append(t.Rows, listToValue(valueConverter{}, nil, cells))
+	}
+	return t, true
+}
@@ -0,0 +1,95 @@
+package up
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/uplang/go/value"
+)
+
+func TestToValue(t *testing.T) {
+	input := "!use [time, id]\n" +
+		"inline [a, b]\n" +
+		"multi [\na\nb\n]\n" +
+		"text ```\nline one\nline two\n```\n" +
+		"note ```\nsingle line\n```\n" +
+		"server {\nhost localhost\nmotd ```\nwelcome\n```\n}\n" +
+		"!lint {\nno-empty-values!level warning\n}\n"
+
+	doc, err := NewParser().ParseDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	values := make(map[string]value.Value)
+	for key, v := range doc.Values() {
+		values[key] = v
+	}
+
+	inline, ok := values["inline"].(value.List)
+	if !ok {
+		t.Fatalf("inline list: expected value.List, got %T", values["inline"])
+	}
+	multi, ok := values["multi"].(value.List)
+	if !ok {
+		t.Fatalf("multi-line list: expected value.List, got %T", values["multi"])
+	}
+	if len(inline) != 2 || len(multi) != 2 || inline[0] != multi[0] {
+		t.Errorf("lists differ: %v vs %v", inline, multi)
+	}
+
+	if values["text"].Kind() != value.KindMultiline {
+		t.Errorf("text: expected multiline, got %s", values["text"].Kind())
+	}
+	if s, _ := value.Text(values["text"]); s != "line one\nline two" {
+		t.Errorf("text: unexpected content %q", s)
+	}
+
+	// The form is recorded by the parser, not guessed from the text
+	if values["note"] != value.Multiline("single line") {
+		t.Errorf("note: expected multiline, got %#v", values["note"])
+	}
+	if v := ToValue("line one\nline two"); v.Kind() != value.KindString {
+		t.Errorf("ToValue: expected string for unparsed text, got %s", v.Kind())
+	}
+
+	server := values["server"].(value.Block)
+	if server["host"] != value.String("localhost") {
+		t.Errorf("server.host: got %v", server["host"])
+	}
+	if server["motd"] != value.Multiline("welcome") {
+		t.Errorf("server.motd: expected multiline, got %#v", server["motd"])
+	}
+
+	if len(doc.Directives) != 2 {
+		t.Fatalf("Expected 2 directives, got %d", len(doc.Directives))
+	}
+	use := doc.Directives[0].ToValue()
+	if use.Name != "use" || strings.Join(use.Args, ",") != "time,id" {
+		t.Errorf("unexpected !use directive: %+v", use)
+	}
+	lint := doc.Directives[1].ToValue()
+	if lint.Name != "lint" || lint.Body["no-empty-values"] != value.String("warning") {
+		t.Errorf("unexpected !lint directive: %+v", lint)
+	}
+}
+
+func TestFromValue(t *testing.T) {
+	table := value.Table{
+		Columns: []string{"name", "age"},
+		Rows:    []value.List{{value.String("ann"), value.String("30")}},
+	}
+	round := ToValue(FromValue(table))
+	if got, ok := round.(value.Table); !ok || len(got.Rows) != 1 || got.Columns[1] != "age" {
+		t.Errorf("table round trip: %#v", round)
+	}
+
+	block := value.Block{"items": value.List{value.String("a")}, "text": value.Multiline("a\nb")}
+	if !Equal(FromValue(block), Block{"items": List{"a"}, "text": "a\nb"}) {
+		t.Errorf("unexpected FromValue result: %#v", FromValue(block))
+	}
+
+	if _, ok := FromValue(value.Directive{Name: "use", Args: []string{"x"}}).(UseDirective); !ok {
+		t.Error("expected !use directive to convert to UseDirective")
+	}
+}
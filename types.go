@@ -8,12 +8,29 @@ type Value any
 type Node struct {
 	Key   string // The key name
 	Type  string // Optional type annotation (e.g., "int", "bool", "string")
-	Value Value  // The parsed value (string, Block, List, Table, or UseDirective)
+	Value Value  // The parsed value (string, Block, List, or Table)
 }
 
 // Document represents a parsed UP document.
 type Document struct {
-	Nodes []Node // Ordered list of top-level nodes
+	Nodes      []Node      // Ordered list of top-level nodes
+	Directives []Directive // Document-level directives in order of appearance
+
+	annotations map[string]string   // type annotations of nested keys, by path
+	positions   map[string]Position // source positions recorded by the parser, by path
+	multiline   map[string]bool     // paths of values written with ``` fences
+}
+
+// Position is a location in the source of a parsed document.
+type Position struct {
+	Line   int // 1-based line number
+	Column int // 1-based column of the first non-blank character
+}
+
+// Directive represents a document-level directive such as !use or !lint.
+type Directive struct {
+	Name  string // Directive name without the leading '!' (e.g., "use")
+	Value Value  // Parsed payload: UseDirective for !use, Block for !lint
 }
 
 // Block represents a UP block structure { ... }.
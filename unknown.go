@@ -0,0 +1,71 @@
+package up
+
+import (
+	"fmt"
+	"sort"
+)
+
+// UnknownFieldError reports a document key that does not match any field
+// of the destination struct when unknown fields are disallowed.
+type UnknownFieldError struct {
+	Key        string   // the unknown key, such as "prot"
+	Path       string   // full path of the key, such as "server.prot"
+	Position   Position // source position of the key
+	Suggestion string   // closest known key, or ""
+}
+
+func (e *UnknownFieldError) Error() string {
+	msg := fmt.Sprintf("%s: %s: unknown field %q", e.Position, e.Path, e.Key)
+	if e.Suggestion != "" {
+		msg += fmt.Sprintf(", did you mean %q?", e.Suggestion)
+	}
+	return msg
+}
+
+// suggestKey returns the known key closest to key, if it is close enough
+// to be a likely typo.
+func suggestKey(key string, known map[string]bool) string {
+	candidates := make([]string, 0, len(known))
+	for k := range known {
+		candidates = append(candidates, k)
+	}
+	sort.Strings(candidates)
+
+	best, bestDist := "", len(key)/3+1
+	if bestDist > 3 {
+		bestDist = 3
+	}
+	for _, c := range candidates {
+		if d := editDistance(key, c); d <= bestDist && (best == "" || d < editDistance(key, best)) {
+			best = c
+		}
+	}
+	return best
+}
+
+// editDistance returns the Damerau-Levenshtein (optimal string alignment)
+// distance between a and b, so that swapped letters count as one edit.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
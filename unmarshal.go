@@ -1,6 +1,8 @@
 package up
 
 import (
+	"encoding"
+	"errors"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -14,6 +16,27 @@ import (
 //   - `up:"fieldname"` - maps UP key "fieldname" to this struct field
 //   - `up:"fieldname,omitempty"` - omits field if value is empty
 //   - `up:"-"` - ignores this field
+//   - `up:",inline"` - reads the fields of a struct from the enclosing block;
+//     untagged embedded structs are inlined as well
+//   - `up:",remain"` - collects the keys not mapped to any other field into a
+//     map[string]any or Block
+//   - `up:"port,default=8080"` - value used when the key is missing; the
+//     default runs to the end of the tag, so it must be the last option
+//   - `env:"APP_PORT"` - environment variable that overrides the document
+//
+// Defaults and environment variables are decoded like document values;
+// for lists and blocks they use the inline syntax, such as "[a, b]".
+//
+// Decoding stops at the first value that cannot be decoded and returns an
+// *UnmarshalError; use a Decoder with CollectErrors to report them all.
+// Validate tags and Validate methods are not checked; use a Decoder with
+// ValidateStructs, or call ValidateStruct on the result.
+//
+// Untagged fields match their lower-cased name; use a Decoder with
+// SetNaming for other conventions. Fields whose type implements
+// Unmarshaler or encoding.TextUnmarshaler decode themselves.
+// time.Duration ("30s"), time.Time (RFC 3339 or YYYY-MM-DD), url.URL,
+// ByteSize ("10MiB") and the netip and regexp types are supported as well.
 //
 // Example:
 //
@@ -36,8 +59,65 @@ func Unmarshal(data []byte, v any) error {
 	return UnmarshalDocument(doc, v)
 }
 
+// Unmarshaler is implemented by types that decode themselves from a UP
+// value. UnmarshalUP receives the parsed value (a string, Block, List or
+// table) and its type annotation, or "" if it has none.
+type Unmarshaler interface {
+	UnmarshalUP(value Value, typ string) error
+}
+
+// UnmarshalError describes a document value that could not be decoded into
+// its destination.
+type UnmarshalError struct {
+	Path     string   // UP path of the value, such as "database.replicas[2].port"
+	Field    string   // Go path of the destination, such as "Config.Database.Replicas[2].Port"
+	Position Position // source position of the value or its nearest ancestor
+	Type     string   // Go type of the destination, such as "int"
+	Value    Value    // the value from the document, or nil if it is missing
+	Err      error
+}
+
+func (e *UnmarshalError) Error() string {
+	if e.Position.IsValid() {
+		return fmt.Sprintf("%s: %s: %v", e.Position, e.Path, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *UnmarshalError) Unwrap() error {
+	return e.Err
+}
+
 // UnmarshalDocument unmarshals a parsed Document into v.
 func UnmarshalDocument(doc *Document, v any) error {
+	return (&decodeState{}).unmarshalDocument(doc, v)
+}
+
+// UnmarshalDocumentStrict is like UnmarshalDocument but fails if the
+// document contains keys, at any depth, that do not match a field of the
+// destination struct. Every such key is reported as an
+// *UnknownFieldError, joined into a single error.
+func UnmarshalDocumentStrict(doc *Document, v any) error {
+	return (&decodeState{disallowUnknownFields: true}).unmarshalDocument(doc, v)
+}
+
+// decodeState holds the options and the document of a single decoding run.
+type decodeState struct {
+	doc                   *Document
+	disallowUnknownFields bool
+	naming                NamingStrategy // key of untagged fields
+	unknown               []error        // unknown keys found so far
+	sources               map[string]Source
+	collectErrors         bool                  // record decoding errors and continue
+	validate              bool                  // check the result with ValidateStruct
+	errs                  []error               // decoding errors collected so far
+	fields                []string              // Go path of the value being decoded
+	origin                string                // source of the value being decoded, if not the document
+	defaulting            map[reflect.Type]bool // pointer targets being filled with defaults
+}
+
+// unmarshalDocument unmarshals a parsed Document into v.
+func (d *decodeState) unmarshalDocument(doc *Document, v any) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Ptr || rv.IsNil() {
 		return fmt.Errorf("unmarshal target must be a non-nil pointer")
@@ -54,22 +134,68 @@ func UnmarshalDocument(doc *Document, v any) error {
 		data[node.Key] = node.Value
 	}
 
-	return unmarshalStruct(data, elem)
+	d.doc = doc
+	d.unknown = nil
+	d.sources = nil
+	d.errs = nil
+	d.fields = []string{elem.Type().Name()}
+	if err := d.unmarshalStruct(data, elem, nil); err != nil {
+		return err
+	}
+	if len(d.errs) > 0 {
+		// Partially decoded values are not validated
+		return errors.Join(append(d.errs, d.unknown...)...)
+	}
+	if !d.validate {
+		return errors.Join(d.unknown...)
+	}
+
+	sv := &structValidator{doc: doc, naming: d.naming}
+	sv.value(nil, elem)
+	return errors.Join(append(d.unknown, sv.err())...)
 }
 
-// unmarshalStruct unmarshals a map into a struct value
-func unmarshalStruct(data map[string]any, v reflect.Value) error {
+// unmarshalStruct unmarshals a map located at path into a struct value
+func (d *decodeState) unmarshalStruct(data map[string]any, v reflect.Value, path Path) error {
+	known := make(map[string]bool, v.NumField())
+	remain, err := d.unmarshalFields(data, v, path, known)
+	if err != nil {
+		return err
+	}
+
+	if remain.IsValid() {
+		setRemain(remain, data, known)
+		return nil
+	}
+
+	if d.disallowUnknownFields {
+		for _, c := range mapChildren(data) {
+			if !known[c.elem.Key] {
+				p := path.Key(c.elem.Key)
+				d.unknown = append(d.unknown, &UnknownFieldError{
+					Key:        c.elem.Key,
+					Path:       p.String(),
+					Position:   d.doc.position(p),
+					Suggestion: suggestKey(c.elem.Key, known),
+				})
+			}
+		}
+	}
+
+	return nil
+}
+
+// unmarshalFields sets the fields of struct v, including those of structs
+// inlined into it, from data. It records the keys mapped to fields in
+// known and returns the ",remain" field, if there is one.
+func (d *decodeState) unmarshalFields(data map[string]any, v reflect.Value, path Path, known map[string]bool) (reflect.Value, error) {
 	t := v.Type()
+	var remain reflect.Value
 
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
 		fieldValue := v.Field(i)
 
-		// Skip unexported fields
-		if !fieldValue.CanSet() {
-			continue
-		}
-
 		// Get UP tag
 		tag := field.Tag.Get("up")
 		if tag == "-" {
@@ -78,39 +204,162 @@ func unmarshalStruct(data map[string]any, v reflect.Value) error {
 
 		// Parse tag options
 		tagName, opts := parseTag(tag)
-		if tagName == "" {
-			// Use field name as default
-			tagName = strings.ToLower(field.Name)
-		}
 
-		// Get value from data
-		value, ok := data[tagName]
-		if !ok {
-			if hasOption(opts, "required") {
-				return fmt.Errorf("required field %s not found", tagName)
+		// Inlined structs read their keys from the same block
+		if isInline(field, tagName, opts) {
+			if !field.Anonymous {
+				d.pushField(field.Name)
+			}
+			r, err := d.unmarshalInline(data, fieldValue, path, known)
+			if !field.Anonymous {
+				d.popField()
+			}
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			if r.IsValid() {
+				remain = r
 			}
 			continue
 		}
 
-		// Check omitempty
-		if hasOption(opts, "omitempty") && isEmpty(value) {
+		// Skip unexported fields
+		if !fieldValue.CanSet() {
+			continue
+		}
+
+		if hasOption(opts, "remain") {
+			if !isRemainType(field.Type) {
+				return reflect.Value{}, fmt.Errorf("field %s: remain requires map[string]any or Block, got %s", field.Name, field.Type)
+			}
+			remain = fieldValue
 			continue
 		}
 
+		if tagName == "" {
+			// Derive the key from the field name
+			tagName = d.naming.match(data, field.Name)
+		}
+		known[tagName] = true
+		fieldPath := path.Key(tagName)
+		if err := d.unmarshalField(data, field, fieldValue, tagName, fieldPath); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+
+	return remain, nil
+}
+
+// unmarshalField sets a single struct field located at path from the value
+// of key in data, its default or its environment variable.
+func (d *decodeState) unmarshalField(data map[string]any, field reflect.StructField, fieldValue reflect.Value, key string, fieldPath Path) error {
+	d.pushField(field.Name)
+	defer d.popField()
+
+	tag := field.Tag.Get("up")
+	_, opts := parseTag(tag)
+
+	// Get value from data
+	value, ok := data[key]
+	switch {
+	case ok && hasOption(opts, "omitempty") && isEmpty(value):
+		// Leave the field unchanged
+	case ok:
 		// Set the field value
-		if err := setField(fieldValue, value); err != nil {
-			return fmt.Errorf("field %s: %v", field.Name, err)
+		if err := d.setField(fieldValue, value, fieldPath); err != nil {
+			return err
+		}
+		d.setSource(fieldPath, SourceFile)
+	default:
+		if text, ok := tagDefault(tag); ok {
+			if err := d.setTagValue(fieldValue, text, fieldPath, SourceDefault, "default"); err != nil {
+				return err
+			}
+		} else if _, env := lookupEnv(field); hasOption(opts, "required") && !env {
+			if err := d.fail(fieldPath, field.Type, nil, errors.New("required field not found")); err != nil {
+				return err
+			}
+		} else if err := d.applyNestedDefaults(fieldValue, fieldPath); err != nil {
+			return err
 		}
 	}
 
-	return nil
+	// Environment variables override the document
+	return d.applyEnv(field, fieldValue, fieldPath)
+}
+
+// unmarshalInline sets an inlined struct field from the enclosing block. A
+// nil pointer is only allocated if the block has any of its keys.
+func (d *decodeState) unmarshalInline(data map[string]any, field reflect.Value, path Path, known map[string]bool) (reflect.Value, error) {
+	if field.Kind() != reflect.Ptr {
+		return d.unmarshalFields(data, field, path, known)
+	}
+	if !field.IsNil() {
+		return d.unmarshalFields(data, field.Elem(), path, known)
+	}
+	if !field.CanSet() {
+		return reflect.Value{}, nil
+	}
+
+	elem := reflect.New(field.Type().Elem())
+	inner := make(map[string]bool)
+	remain, err := d.unmarshalFields(data, elem.Elem(), path, inner)
+	if err != nil {
+		return reflect.Value{}, err
+	}
+	used := remain.IsValid()
+	for key := range inner {
+		known[key] = true
+		if _, ok := data[key]; ok {
+			used = true
+		}
+	}
+	if used {
+		field.Set(elem)
+	}
+	return remain, nil
 }
 
-// setField sets a reflect.Value based on the any value
-func setField(field reflect.Value, value any) error {
+// setRemain stores the entries of data that are not mapped to any field in
+// a ",remain" field.
+func setRemain(field reflect.Value, data map[string]any, known map[string]bool) {
+	t := field.Type()
+	for key, value := range data {
+		if known[key] {
+			continue
+		}
+		if field.IsNil() {
+			field.Set(reflect.MakeMap(t))
+		}
+		field.SetMapIndex(reflect.ValueOf(key).Convert(t.Key()), reflect.ValueOf(&value).Elem())
+	}
+}
+
+// setField sets a reflect.Value based on the any value located at path.
+// Supported standard library types are decoded first, then types
+// implementing Unmarshaler or encoding.TextUnmarshaler decode themselves;
+// other types are decoded according to their kind. Failures are reported
+// as *UnmarshalError.
+func (d *decodeState) setField(field reflect.Value, value any, path Path) error {
 	if value == nil {
 		return nil
 	}
+	err := d.setValue(field, value, path)
+	if _, ok := err.(*UnmarshalError); err == nil || ok {
+		return err
+	}
+	return d.fail(path, field.Type(), value, err)
+}
+
+// setValue does the work of setField. Errors of nested values are already
+// reported as *UnmarshalError; other errors concern value itself.
+func (d *decodeState) setValue(field reflect.Value, value any, path Path) error {
+	if handled, err := unmarshalBuiltin(field, value); handled {
+		return err
+	}
+	if handled, err := d.unmarshalCustom(field, value, path); handled {
+		return err
+	}
 
 	switch field.Kind() {
 	case reflect.String:
@@ -124,13 +373,13 @@ func setField(field reflect.Value, value any) error {
 	case reflect.Bool:
 		return setBool(field, value)
 	case reflect.Slice:
-		return setSlice(field, value)
+		return d.setSlice(field, value, path)
 	case reflect.Map:
-		return setMap(field, value)
+		return d.setMap(field, value, path)
 	case reflect.Struct:
-		return setStruct(field, value)
+		return d.setStruct(field, value, path)
 	case reflect.Ptr:
-		return setPointer(field, value)
+		return d.setPointer(field, value, path)
 	case reflect.Interface:
 		field.Set(reflect.ValueOf(value))
 		return nil
@@ -227,21 +476,53 @@ func setBool(field reflect.Value, value any) error {
 	return nil
 }
 
-func setSlice(field reflect.Value, value any) error {
+// unmarshalCustom decodes value with the field's Unmarshaler or
+// encoding.TextUnmarshaler implementation. It reports whether the field
+// implements either interface.
+func (d *decodeState) unmarshalCustom(field reflect.Value, value any, path Path) (bool, error) {
+	if field.Kind() == reflect.Ptr || !field.CanAddr() {
+		// Pointers are allocated by setPointer and checked again.
+		return false, nil
+	}
+
+	var err error
+	switch u := field.Addr().Interface().(type) {
+	case Unmarshaler:
+		err = u.UnmarshalUP(value, d.doc.annotation(path))
+	case encoding.TextUnmarshaler:
+		s, ok := value.(string)
+		if !ok {
+			err = fmt.Errorf("cannot unmarshal %s into %s", describeValue(value), field.Type())
+			break
+		}
+		err = u.UnmarshalText([]byte(s))
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+func (d *decodeState) setSlice(field reflect.Value, value any, path Path) error {
 	switch v := value.(type) {
 	case List:
 		slice := reflect.MakeSlice(field.Type(), len(v), len(v))
 		for i, item := range v {
-			if err := setField(slice.Index(i), item); err != nil {
-				return fmt.Errorf("index %d: %v", i, err)
+			d.pushField(fmt.Sprintf("[%d]", i))
+			err := d.setField(slice.Index(i), item, path.Index(i))
+			d.popField()
+			if err != nil {
+				return err
 			}
 		}
 		field.Set(slice)
 	case []any:
 		slice := reflect.MakeSlice(field.Type(), len(v), len(v))
 		for i, item := range v {
-			if err := setField(slice.Index(i), item); err != nil {
-				return fmt.Errorf("index %d: %v", i, err)
+			d.pushField(fmt.Sprintf("[%d]", i))
+			err := d.setField(slice.Index(i), item, path.Index(i))
+			d.popField()
+			if err != nil {
+				return err
 			}
 		}
 		field.Set(slice)
@@ -251,15 +532,18 @@ func setSlice(field reflect.Value, value any) error {
 	return nil
 }
 
-func setMap(field reflect.Value, value any) error {
+func (d *decodeState) setMap(field reflect.Value, value any, path Path) error {
 	switch v := value.(type) {
 	case Block:
 		m := reflect.MakeMap(field.Type())
 		for key, val := range v {
 			keyValue := reflect.ValueOf(key)
 			elemValue := reflect.New(field.Type().Elem()).Elem()
-			if err := setField(elemValue, val); err != nil {
-				return fmt.Errorf("key %s: %v", key, err)
+			d.pushField(fmt.Sprintf("[%q]", key))
+			err := d.setField(elemValue, val, path.Key(key))
+			d.popField()
+			if err != nil {
+				return err
 			}
 			m.SetMapIndex(keyValue, elemValue)
 		}
@@ -269,8 +553,11 @@ func setMap(field reflect.Value, value any) error {
 		for key, val := range v {
 			keyValue := reflect.ValueOf(key)
 			elemValue := reflect.New(field.Type().Elem()).Elem()
-			if err := setField(elemValue, val); err != nil {
-				return fmt.Errorf("key %s: %v", key, err)
+			d.pushField(fmt.Sprintf("[%q]", key))
+			err := d.setField(elemValue, val, path.Key(key))
+			d.popField()
+			if err != nil {
+				return err
 			}
 			m.SetMapIndex(keyValue, elemValue)
 		}
@@ -281,7 +568,7 @@ func setMap(field reflect.Value, value any) error {
 	return nil
 }
 
-func setStruct(field reflect.Value, value any) error {
+func (d *decodeState) setStruct(field reflect.Value, value any, path Path) error {
 	switch v := value.(type) {
 	case Block:
 		// Block is map[string]Value, convert to map[string]any
@@ -289,15 +576,15 @@ func setStruct(field reflect.Value, value any) error {
 		for k, val := range v {
 			m[k] = val
 		}
-		return unmarshalStruct(m, field)
+		return d.unmarshalStruct(m, field, path)
 	case map[string]any:
-		return unmarshalStruct(v, field)
+		return d.unmarshalStruct(v, field, path)
 	default:
 		return fmt.Errorf("cannot convert %T to struct", v)
 	}
 }
 
-func setPointer(field reflect.Value, value any) error {
+func (d *decodeState) setPointer(field reflect.Value, value any, path Path) error {
 	if value == nil {
 		field.Set(reflect.Zero(field.Type()))
 		return nil
@@ -305,13 +592,57 @@ func setPointer(field reflect.Value, value any) error {
 
 	// Create new pointer
 	ptr := reflect.New(field.Type().Elem())
-	if err := setField(ptr.Elem(), value); err != nil {
+	if err := d.setField(ptr.Elem(), value, path); err != nil {
 		return err
 	}
 	field.Set(ptr)
 	return nil
 }
 
+// fail reports an error decoding value at path into a destination of type
+// t. When errors are collected it records the error and returns nil.
+func (d *decodeState) fail(path Path, t reflect.Type, value any, err error) error {
+	if d.origin != "" {
+		err = fmt.Errorf("%s: %w", d.origin, err)
+	}
+	e := &UnmarshalError{
+		Path:     displayPath(path),
+		Field:    fieldPath(d.fields),
+		Position: d.doc.position(path),
+		Type:     t.String(),
+		Value:    value,
+		Err:      err,
+	}
+	if d.collectErrors {
+		d.errs = append(d.errs, e)
+		return nil
+	}
+	return e
+}
+
+// pushField enters a struct field or, for "[...]", an element of the value
+// being decoded.
+func (d *decodeState) pushField(name string) {
+	d.fields = append(d.fields, name)
+}
+
+// popField leaves the innermost field or element.
+func (d *decodeState) popField() {
+	d.fields = d.fields[:len(d.fields)-1]
+}
+
+// fieldPath renders a Go path such as Config.Servers[0].Port.
+func fieldPath(fields []string) string {
+	var sb strings.Builder
+	for i, f := range fields {
+		if i > 0 && !strings.HasPrefix(f, "[") {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(f)
+	}
+	return sb.String()
+}
+
 // Helper functions
 
 func parseTag(tag string) (string, []string) {
@@ -319,6 +650,10 @@ func parseTag(tag string) (string, []string) {
 	if len(parts) == 0 {
 		return "", nil
 	}
+	if strings.HasPrefix(parts[0], "default=") {
+		// `up:"default=8080"` sets a default without naming the key
+		return "", parts
+	}
 	return parts[0], parts[1:]
 }
 
@@ -331,6 +666,30 @@ func hasOption(opts []string, option string) bool {
 	return false
 }
 
+// isInline reports whether the keys of a struct field are read from and
+// written to the enclosing block: fields tagged ",inline" and untagged
+// embedded structs that do not decode themselves.
+func isInline(field reflect.StructField, name string, opts []string) bool {
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	if hasOption(opts, "inline") {
+		return true
+	}
+	return field.Anonymous && name == "" && customKind(t) == ""
+}
+
+// isRemainType reports whether t can hold the keys collected by a ",remain"
+// field: a map with string keys and interface values, such as Block.
+func isRemainType(t reflect.Type) bool {
+	return t.Kind() == reflect.Map && t.Key().Kind() == reflect.String &&
+		t.Elem().Kind() == reflect.Interface && t.Elem().NumMethod() == 0
+}
+
 func isEmpty(value any) bool {
 	if value == nil {
 		return true
@@ -0,0 +1,471 @@
+package up
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLevel decodes itself from a scalar and records the annotation it
+// was written with.
+type testLevel struct {
+	Name string
+	Type string
+}
+
+func (l *testLevel) UnmarshalUP(value Value, typ string) error {
+	s, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("level must be a scalar, got %T", value)
+	}
+	switch s {
+	case "low", "high":
+		l.Name, l.Type = s, typ
+		return nil
+	}
+	return fmt.Errorf("unknown level %q", s)
+}
+
+func (l testLevel) MarshalUP() (Value, string, error) {
+	return l.Name, "level", nil
+}
+
+func TestUnmarshalCustomTypes(t *testing.T) {
+	type config struct {
+		Level  testLevel   `up:"level"`
+		Levels []testLevel `up:"levels"`
+		Addr   net.IP      `up:"addr"`
+		Big    *big.Int    `up:"big"`
+	}
+
+	input := `level!level high
+levels [low, high]
+addr 10.0.0.1
+big 123456789012345678901234567890
+`
+	var cfg config
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+
+	if cfg.Level != (testLevel{Name: "high", Type: "level"}) {
+		t.Errorf("Unexpected level: %+v", cfg.Level)
+	}
+	if len(cfg.Levels) != 2 || cfg.Levels[0].Name != "low" || cfg.Levels[1].Type != "" {
+		t.Errorf("Unexpected levels: %+v", cfg.Levels)
+	}
+	if !cfg.Addr.Equal(net.ParseIP("10.0.0.1")) {
+		t.Errorf("Unexpected addr: %v", cfg.Addr)
+	}
+	if cfg.Big == nil || cfg.Big.String() != "123456789012345678901234567890" {
+		t.Errorf("Unexpected big: %v", cfg.Big)
+	}
+
+	out, err := Marshal(&cfg)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	expected := "level!level high\nlevels [\n  low\n  high\n]\naddr 10.0.0.1\nbig 123456789012345678901234567890\n"
+	if string(out) != expected {
+		t.Errorf("Marshal() mismatch:\nexpected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"level medium", `unknown level "medium"`},
+		{"addr {\n  a b\n}", "cannot unmarshal block into net.IP"},
+		{"addr not-an-ip", "invalid IP address"},
+	}
+	for _, tt := range tests {
+		var cfg config
+		err := Unmarshal([]byte(tt.input), &cfg)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Unmarshal(%q): expected error containing %q, got %v", tt.input, tt.want, err)
+		}
+	}
+}
+
+func TestUnmarshalBuiltinTypes(t *testing.T) {
+	type config struct {
+		Timeout  time.Duration  `up:"timeout"`
+		Started  time.Time      `up:"started"`
+		Day      time.Time      `up:"day"`
+		MaxBody  ByteSize       `up:"max_body"`
+		Listen   netip.AddrPort `up:"listen"`
+		Allow    netip.Prefix   `up:"allow"`
+		Gateway  netip.Addr     `up:"gateway"`
+		Endpoint *url.URL       `up:"endpoint"`
+		Match    *regexp.Regexp `up:"match"`
+		Server   struct {
+			Grace time.Duration `up:"grace"`
+		} `up:"server"`
+	}
+
+	input := `timeout 30s
+started 2024-01-02T15:04:05Z
+day 2024-03-04
+max_body 10MiB
+listen 0.0.0.0:8080
+allow 10.0.0.0/8
+gateway 10.0.0.1
+endpoint https://example.com/api?x=1
+match ^v[0-9]+$
+server {
+  grace 1m30s
+}
+`
+	var cfg config
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+
+	if cfg.Timeout != 30*time.Second || cfg.Server.Grace != 90*time.Second {
+		t.Errorf("Unexpected durations: %v, %v", cfg.Timeout, cfg.Server.Grace)
+	}
+	if !cfg.Started.Equal(time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)) ||
+		!cfg.Day.Equal(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected times: %v, %v", cfg.Started, cfg.Day)
+	}
+	if cfg.MaxBody != 10*Mebibyte {
+		t.Errorf("Expected 10MiB, got %d", cfg.MaxBody)
+	}
+	if cfg.Listen.String() != "0.0.0.0:8080" || cfg.Allow.String() != "10.0.0.0/8" || cfg.Gateway.String() != "10.0.0.1" {
+		t.Errorf("Unexpected network values: %v %v %v", cfg.Listen, cfg.Allow, cfg.Gateway)
+	}
+	if cfg.Endpoint == nil || cfg.Endpoint.Host != "example.com" || cfg.Endpoint.Query().Get("x") != "1" {
+		t.Errorf("Unexpected endpoint: %v", cfg.Endpoint)
+	}
+	if cfg.Match == nil || !cfg.Match.MatchString("v12") {
+		t.Errorf("Unexpected match: %v", cfg.Match)
+	}
+
+	out, err := Marshal(&cfg)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	for _, want := range []string{"timeout 30s\n", "max_body 10MiB\n", "endpoint https://example.com/api?x=1\n", "  grace 1m30s\n"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("Expected Marshal() output to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"server {\n  grace soon\n}", `server.grace: invalid duration "soon"`},
+		{"started yesterday", `started: invalid time "yesterday"`},
+		{"max_body 10XB", `max_body: invalid byte size "10XB"`},
+		{"allow 10.0.0.0/99", "allow: netip.ParsePrefix"},
+		{"match a(b", "match: error parsing regexp"},
+	}
+	for _, tt := range tests {
+		var cfg config
+		err := Unmarshal([]byte(tt.input), &cfg)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Unmarshal(%q): expected error containing %q, got %v", tt.input, tt.want, err)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  ByteSize
+	}{
+		{"512", 512},
+		{"512B", 512},
+		{"10kB", 10000},
+		{"10mb", 10 * Megabyte},
+		{"1.5GiB", 3 * Gibibyte / 2},
+		{"2K", 2048},
+		{"1 TiB", Tebibyte},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.input)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseByteSize(%q): expected %d, got %d (%v)", tt.input, tt.want, got, err)
+		}
+	}
+
+	for _, bad := range []string{"", "MiB", "-1", "1.2.3", "9999999PiB"} {
+		if _, err := ParseByteSize(bad); err == nil {
+			t.Errorf("ParseByteSize(%q): expected error", bad)
+		}
+	}
+
+	if s := (1536 * Mebibyte).String(); s != "1536MiB" {
+		t.Errorf("Expected 1536MiB, got %s", s)
+	}
+	if s := ByteSize(1500).String(); s != "1500" {
+		t.Errorf("Expected 1500, got %s", s)
+	}
+}
+
+func TestUnmarshalDocumentStrict(t *testing.T) {
+	type config struct {
+		Name   string `up:"name"`
+		Server struct {
+			Host string `up:"host"`
+			Port int    `up:"port"`
+		} `up:"server"`
+		Routes []struct {
+			Path string `up:"path"`
+		} `up:"routes"`
+	}
+
+	input := `name demo
+server {
+  host localhost
+  prot!int 8080
+}
+routes [
+  {
+    path /
+    methdo GET
+  }
+]
+colour blue
+`
+	doc, err := NewParser().ParseDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	var cfg config
+	if err := UnmarshalDocument(doc, &cfg); err != nil {
+		t.Fatalf("UnmarshalDocument() failed: %v", err)
+	}
+
+	err = UnmarshalDocumentStrict(doc, &cfg)
+	if err == nil {
+		t.Fatal("Expected unknown field errors")
+	}
+	expected := []string{
+		`4:3: server.prot: unknown field "prot", did you mean "port"?`,
+		`9:5: routes[0].methdo: unknown field "methdo"`,
+		`12:1: colour: unknown field "colour"`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got:\n%v", want, err)
+		}
+	}
+
+	var unknown *UnknownFieldError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("Expected *UnknownFieldError, got %T", err)
+	}
+	if unknown.Suggestion != "port" {
+		t.Errorf("Expected suggestion port, got %q", unknown.Suggestion)
+	}
+}
+
+func TestSuggestKey(t *testing.T) {
+	known := map[string]bool{"port": true, "host": true, "timeout": true}
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"prot", "port"},
+		{"hots", "host"},
+		{"timeot", "timeout"},
+		{"colour", ""},
+		{"x", ""},
+	}
+	for _, tt := range tests {
+		if got := suggestKey(tt.key, known); got != tt.expected {
+			t.Errorf("suggestKey(%q): expected %q, got %q", tt.key, tt.expected, got)
+		}
+	}
+}
+
+type testBase struct {
+	Name    string `up:"name"`
+	Version int    `up:"version"`
+}
+
+type testTLS struct {
+	Cert string `up:"cert"`
+	Key  string `up:"key"`
+}
+
+func TestUnmarshalInlineAndRemain(t *testing.T) {
+	type config struct {
+		testBase
+		TLS     *testTLS       `up:",inline"`
+		Port    int            `up:"port"`
+		Plugins map[string]any `up:",remain"`
+	}
+
+	input := `name demo
+version!int 2
+port!int 8080
+cert server.pem
+metrics {
+  enabled true
+}
+`
+	doc, err := NewParser().ParseDocument(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	var cfg config
+	if err := UnmarshalDocumentStrict(doc, &cfg); err != nil {
+		t.Fatalf("UnmarshalDocumentStrict() failed: %v", err)
+	}
+	if cfg.Name != "demo" || cfg.Version != 2 || cfg.Port != 8080 {
+		t.Errorf("Unexpected result: %+v", cfg)
+	}
+	if cfg.TLS == nil || cfg.TLS.Cert != "server.pem" {
+		t.Errorf("Expected inlined TLS cert, got %+v", cfg.TLS)
+	}
+	if len(cfg.Plugins) != 1 {
+		t.Fatalf("Expected 1 remaining key, got %v", cfg.Plugins)
+	}
+	if metrics, ok := cfg.Plugins["metrics"].(Block); !ok || metrics["enabled"] != "true" {
+		t.Errorf("Expected metrics block in remainder, got %#v", cfg.Plugins["metrics"])
+	}
+
+	out, err := Marshal(cfg)
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	expected := `name demo
+version!int 2
+cert server.pem
+key
+port!int 8080
+metrics {
+  enabled true
+}
+`
+	if string(out) != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	var bare config
+	if err := Unmarshal([]byte("name demo\n"), &bare); err != nil {
+		t.Fatalf("Unmarshal() failed: %v", err)
+	}
+	if bare.TLS != nil || bare.Plugins != nil {
+		t.Errorf("Expected absent inline and remain fields to stay nil, got %+v", bare)
+	}
+
+	schema, err := SchemaOf(config{})
+	if err != nil {
+		t.Fatalf("SchemaOf() failed: %v", err)
+	}
+	var names []string
+	for _, f := range schema.Fields {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, " ") != "name version cert key port" || !schema.Additional {
+		t.Errorf("Unexpected schema fields %v (additional %v)", names, schema.Additional)
+	}
+
+	type invalid struct {
+		Rest []string `up:",remain"`
+	}
+	if err := Unmarshal([]byte("a 1\n"), &invalid{}); err == nil || !strings.Contains(err.Error(), "remain requires") {
+		t.Errorf("Expected remain type error, got %v", err)
+	}
+}
+
+type testListener struct {
+	Port int    `up:"port" validate:"min=1,max=65535"`
+	Mode string `up:"mode" validate:"oneof=plain tls"`
+	Cert string `up:"cert" validate:"required_if=Mode tls"`
+}
+
+func (l *testListener) Validate() error {
+	if l.Mode == "plain" && l.Port == 443 {
+		return fmt.Errorf("port 443 requires tls")
+	}
+	return nil
+}
+
+func TestUnmarshalValidation(t *testing.T) {
+	type config struct {
+		Name      string         `up:"name" validate:"nonempty,pattern=^[a-z]{2,8}$"`
+		Tags      []string       `up:"tags" validate:"max=2"`
+		Code      string         `up:"code" validate:"len=3"`
+		Listeners []testListener `up:"listeners"`
+	}
+
+	input := `name Demo
+tags [a, b, c]
+code abc
+listeners [
+  {
+    port!int 443
+    mode plain
+  }
+  {
+    port!int 70000
+    mode tls
+  }
+]
+`
+	var cfg config
+	if err := Unmarshal([]byte(input), &cfg); err != nil {
+		t.Fatalf("Unmarshal validated the result: %v", err)
+	}
+	dec := NewDecoder(strings.NewReader(input))
+	dec.ValidateStructs()
+	err := dec.Decode(&cfg)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Expected *ValidationError, got %v", err)
+	}
+
+	expected := []string{
+		`1:1: name: "Demo" does not match pattern "^[a-z]{2,8}$"`,
+		`2:1: tags: has 3 items, expected at most 2`,
+		`5:3: listeners[0]: port 443 requires tls`,
+		`10:5: listeners[1].port: 70000 is greater than the maximum 65535`,
+		`9:3: listeners[1].cert: missing value, required when Mode is tls`,
+	}
+	if len(verr.Violations) != len(expected) {
+		t.Fatalf("Expected %d violations, got:\n%v", len(expected), err)
+	}
+	for i, want := range expected {
+		if got := verr.Violations[i].String(); got != want {
+			t.Errorf("Violation %d: expected %q, got %q", i, want, got)
+		}
+	}
+
+	// Paths use the keys matched case-insensitively in the document
+	type server struct {
+		MaxConns int `validate:"max=10"`
+	}
+	type named struct {
+		Server server
+	}
+	dec = NewDecoder(strings.NewReader("SERVER {\n  maxConns!int 20\n}\n"))
+	dec.SetNaming(NamingCaseInsensitive)
+	dec.ValidateStructs()
+	err = dec.Decode(&named{})
+	if err == nil || err.Error() != "2:3: SERVER.maxConns: 20 is greater than the maximum 10" {
+		t.Errorf("Unexpected case-insensitive error: %v", err)
+	}
+
+	cfg = config{Name: "ok", Code: "xyz", Listeners: []testListener{{Port: 80, Mode: "plain"}}}
+	if err := ValidateStruct(&cfg); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	cfg.Code = ""
+	if err := ValidateStruct(cfg); err == nil || err.Error() != "code: has 0 characters, expected 3" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
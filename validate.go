@@ -0,0 +1,317 @@
+package up
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Validator is implemented by types that check themselves once they have
+// been decoded. Validate is called on every struct reached by
+// ValidateStruct, after the rules of its fields' validate tags.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is returned when a decoded value breaks the rules of its
+// validate tags or its Validate method. It lists every failure.
+type ValidationError struct {
+	Violations Violations
+}
+
+func (e *ValidationError) Error() string {
+	return strings.TrimSuffix(e.Violations.String(), "\n")
+}
+
+// ValidateStruct checks v, a struct or a pointer to one, against the
+// validate tags of its fields and the Validate methods of the values it
+// contains. A Decoder does this after decoding when ValidateStructs is set.
+// The supported rules are:
+//   - `validate:"nonempty"` - the value must not be empty or zero
+//   - `validate:"min=1,max=10"` - bounds of a number, or of the length of a
+//     string, list or map
+//   - `validate:"len=3"` - exact length of a string, list or map
+//   - `validate:"oneof=debug info warn"` - allowed values, space separated
+//   - `validate:"pattern=^[a-z]+$"` - regular expression a string must match;
+//     the pattern runs to the end of the tag, so it must be the last rule
+//   - `validate:"required_if=Mode tls"` - the value must not be empty when
+//     the sibling field Mode has the value tls
+//
+// The result is a *ValidationError, or nil if v is valid.
+func ValidateStruct(v any) error {
+	sv := &structValidator{}
+	sv.value(nil, reflect.ValueOf(v))
+	return sv.err()
+}
+
+// structValidator accumulates violations while validating a Go value.
+type structValidator struct {
+	doc        *Document // source of positions, if any
+	naming     NamingStrategy
+	patterns   map[string]*regexp.Regexp
+	violations Violations
+}
+
+// report records a violation at path.
+func (sv *structValidator) report(path Path, format string, args ...any) {
+	var pos Position
+	if sv.doc != nil {
+		pos = sv.doc.position(path)
+	}
+	sv.violations = append(sv.violations, Violation{
+		Path:     path,
+		Position: pos,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// err returns the violations as a *ValidationError, or nil.
+func (sv *structValidator) err() error {
+	if len(sv.violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: sv.violations}
+}
+
+// value validates rv located at path and everything it contains.
+func (sv *structValidator) value(path Path, rv reflect.Value) {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		if customKind(rv.Type()) == "" {
+			sv.fields(path, rv)
+		}
+		sv.hook(path, rv)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			sv.value(path.Index(i), rv.Index(i))
+		}
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return
+		}
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, k := range keys {
+			sv.value(path.Key(k.String()), rv.MapIndex(k))
+		}
+	}
+}
+
+// fields validates the fields of struct rv located at path.
+func (sv *structValidator) fields(path Path, rv reflect.Value) {
+	t := rv.Type()
+	var block map[string]any // document block of rv, built on first use
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := rv.Field(i)
+		tag := field.Tag.Get("up")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+
+		if isInline(field, name, opts) {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				sv.fields(path, fv)
+				if !field.Anonymous {
+					// Methods of embedded structs are promoted to rv
+					sv.hook(path, fv)
+				}
+			}
+			continue
+		}
+		if !field.IsExported() || hasOption(opts, "remain") {
+			continue
+		}
+		if name == "" {
+			// Like the decoder, NamingCaseInsensitive uses the key found in
+			// the document, so that violations point at the decoded text
+			if block == nil && sv.doc != nil && sv.naming == NamingCaseInsensitive {
+				block = sv.block(path)
+			}
+			name = sv.naming.match(block, field.Name)
+		}
+		p := path.Key(name)
+
+		sv.rules(p, rv, fv, field.Tag.Get("validate"))
+		sv.value(p, fv)
+	}
+}
+
+// block returns the keys of the document block located at path.
+func (sv *structValidator) block(path Path) map[string]any {
+	data := make(map[string]any)
+	if len(path) == 0 {
+		for _, node := range sv.doc.Nodes {
+			data[node.Key] = node.Value
+		}
+	} else if v, ok := lookupPath(sv.doc, path); ok {
+		block, _ := asMap(v)
+		for k, v := range block {
+			data[k] = v
+		}
+	}
+	return data
+}
+
+// hook calls the Validate method of rv, preferring a pointer receiver.
+func (sv *structValidator) hook(path Path, rv reflect.Value) {
+	var v any
+	switch {
+	case rv.CanAddr():
+		v = rv.Addr().Interface()
+	case rv.CanInterface():
+		v = rv.Interface()
+	default:
+		return
+	}
+	if validator, ok := v.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			sv.report(path, "%v", err)
+		}
+	}
+}
+
+// rules checks the validate tag of a field fv of struct parent located at
+// path.
+func (sv *structValidator) rules(path Path, parent, fv reflect.Value, tag string) {
+	if tag == "" {
+		return
+	}
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			break
+		}
+		fv = fv.Elem()
+	}
+
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "nonempty":
+			if isEmptyValue(fv) || fv.IsZero() {
+				sv.report(path, "must not be empty")
+			}
+		case "min", "max", "len":
+			sv.bound(path, fv, name, arg)
+		case "oneof":
+			if isNil(fv) {
+				continue
+			}
+			allowed := strings.Fields(arg)
+			if s := fmt.Sprint(fv.Interface()); !containsString(allowed, s) {
+				sv.report(path, "%q is not one of [%s]", s, strings.Join(allowed, ", "))
+			}
+		case "pattern":
+			// The pattern may contain commas
+			sv.pattern(path, fv, strings.TrimPrefix(strings.TrimSpace(strings.Join(rules[i:], ",")), "pattern="))
+			return
+		case "required_if":
+			sv.requiredIf(path, parent, fv, arg)
+		default:
+			sv.report(path, "invalid validate rule %q", rule)
+		}
+	}
+}
+
+// bound checks a min, max or len rule against a number or a length.
+func (sv *structValidator) bound(path Path, fv reflect.Value, rule, arg string) {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		sv.report(path, "invalid validate rule %s=%s", rule, arg)
+		return
+	}
+
+	var n float64
+	var unit string
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = fv.Float()
+	case reflect.String:
+		n, unit = float64(len([]rune(fv.String()))), "characters"
+	case reflect.Slice, reflect.Array:
+		n, unit = float64(fv.Len()), "items"
+	case reflect.Map:
+		n, unit = float64(fv.Len()), "keys"
+	default:
+		return
+	}
+
+	value := formatBound(n)
+	switch {
+	case unit == "" && rule == "min" && n < limit:
+		sv.report(path, "%s is less than the minimum %s", value, formatBound(limit))
+	case unit == "" && rule == "max" && n > limit:
+		sv.report(path, "%s is greater than the maximum %s", value, formatBound(limit))
+	case unit == "" && rule == "len":
+		sv.report(path, "invalid validate rule len on a number")
+	case unit != "" && rule == "min" && n < limit:
+		sv.report(path, "has %s %s, expected at least %s", value, unit, formatBound(limit))
+	case unit != "" && rule == "max" && n > limit:
+		sv.report(path, "has %s %s, expected at most %s", value, unit, formatBound(limit))
+	case unit != "" && rule == "len" && n != limit:
+		sv.report(path, "has %s %s, expected %s", value, unit, formatBound(limit))
+	}
+}
+
+// pattern checks that a string matches the regular expression expr.
+func (sv *structValidator) pattern(path Path, fv reflect.Value, expr string) {
+	re, ok := sv.patterns[expr]
+	if !ok {
+		var err error
+		if re, err = regexp.Compile(expr); err != nil {
+			sv.report(path, "invalid pattern %q: %v", expr, err)
+			return
+		}
+		if sv.patterns == nil {
+			sv.patterns = make(map[string]*regexp.Regexp)
+		}
+		sv.patterns[expr] = re
+	}
+	if fv.Kind() == reflect.String && !re.MatchString(fv.String()) {
+		sv.report(path, "%q does not match pattern %q", fv.String(), expr)
+	}
+}
+
+// requiredIf checks a required_if rule: arg names a sibling field and the
+// value that makes this field required.
+func (sv *structValidator) requiredIf(path Path, parent, fv reflect.Value, arg string) {
+	name, want, _ := strings.Cut(arg, " ")
+	other := parent.FieldByName(name)
+	if !other.IsValid() {
+		sv.report(path, "invalid validate rule required_if: no field %s", name)
+		return
+	}
+	for other.Kind() == reflect.Ptr && !other.IsNil() {
+		other = other.Elem()
+	}
+	if isNil(other) || fmt.Sprint(other.Interface()) != want {
+		return
+	}
+	if isEmptyValue(fv) || fv.IsZero() {
+		sv.report(path, "missing value, required when %s is %s", name, want)
+	}
+}
+
+// isNil reports whether rv is a nil pointer or interface.
+func isNil(rv reflect.Value) bool {
+	return (rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface) && rv.IsNil()
+}
@@ -0,0 +1,125 @@
+// Package value defines a sealed model for UP values.
+//
+// Unlike the any-based up.Value, every value here implements Value and
+// reports its Kind, and equivalent syntax always produces the same Go type:
+// inline and multi-line lists are both List, and tables are always Table.
+//
+// Migration: the parser still produces up.Value. Convert with up.ToValue
+// and up.FromValue, or range over Document.Values, to adopt this model
+// incrementally.
+package value
+
+import (
+	"sort"
+)
+
+// Kind identifies the kind of a Value.
+type Kind int
+
+// Value kinds.
+const (
+	KindString Kind = iota + 1
+	KindMultiline
+	KindBlock
+	KindList
+	KindTable
+	KindDirective
+)
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case KindString:
+		return "string"
+	case KindMultiline:
+		return "multiline"
+	case KindBlock:
+		return "block"
+	case KindList:
+		return "list"
+	case KindTable:
+		return "table"
+	case KindDirective:
+		return "directive"
+	default:
+		return "invalid"
+	}
+}
+
+// Value is a UP value. The set of implementations is closed: String,
+// Multiline, Block, List, Table and Directive.
+type Value interface {
+	Kind() Kind
+	sealed()
+}
+
+// String is a single-line scalar.
+type String string
+
+// Multiline is a scalar written with ``` fences.
+type Multiline string
+
+// Block is a { ... } block of keyed values.
+type Block map[string]Value
+
+// List is a list, written inline [a, b] or across multiple lines.
+type List []Value
+
+// Table is a table with named columns and rows of values.
+type Table struct {
+	Columns []string
+	Rows    []List
+}
+
+// Directive is a document-level directive such as !use or !lint.
+type Directive struct {
+	Name string   // Directive name without the leading '!'
+	Args []string // Arguments, e.g. the namespaces of !use
+	Body Block    // Block payload, e.g. the rules of !lint
+}
+
+// Kind implements Value.
+func (String) Kind() Kind { return KindString }
+
+// Kind implements Value.
+func (Multiline) Kind() Kind { return KindMultiline }
+
+// Kind implements Value.
+func (Block) Kind() Kind { return KindBlock }
+
+// Kind implements Value.
+func (List) Kind() Kind { return KindList }
+
+// Kind implements Value.
+func (Table) Kind() Kind { return KindTable }
+
+// Kind implements Value.
+func (Directive) Kind() Kind { return KindDirective }
+
+func (String) sealed()    {}
+func (Multiline) sealed() {}
+func (Block) sealed()     {}
+func (List) sealed()      {}
+func (Table) sealed()     {}
+func (Directive) sealed() {}
+
+// Keys returns the keys of the block in sorted order.
+func (b Block) Keys() []string {
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Text returns the text of a String or Multiline value.
+func Text(v Value) (string, bool) {
+	switch v := v.(type) {
+	case String:
+		return string(v), true
+	case Multiline:
+		return string(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,123 @@
+package up
+
+import (
+	"errors"
+)
+
+// SkipChildren can be returned from a WalkFunc to skip the children of the
+// current value. The walk continues with its next sibling.
+var SkipChildren = errors.New("skip children")
+
+// SkipAll can be returned from a WalkFunc to stop the walk. Walk then
+// returns nil.
+var SkipAll = errors.New("skip all")
+
+// Cursor describes the value currently visited by Walk.
+type Cursor struct {
+	Path  Path   // Location of the value
+	Type  string // Type annotation of the value, if any
+	Value Value  // The value itself
+
+	replaced bool
+}
+
+// Replace replaces the current value. When the walk descends, it visits
+// the children of the replacement.
+func (c *Cursor) Replace(v Value) {
+	c.Value = v
+	c.replaced = true
+}
+
+// WalkFunc is called by Walk for every value in a document.
+type WalkFunc func(c *Cursor) error
+
+// Walk visits every value in the document in pre-order: top-level nodes in
+// document order, block entries in sorted key order and list items in
+// index order. Values replaced through the cursor are stored back into the
+// document, and annotations recorded below a replaced value are dropped.
+// Any error other than SkipChildren or SkipAll aborts the walk and is
+// returned.
+func Walk(doc *Document, fn WalkFunc) error {
+	for i := range doc.Nodes {
+		node := &doc.Nodes[i]
+		value, replaced, err := walkValue(doc, Path{{Key: node.Key}}, node.Type, node.Value, fn)
+		if replaced {
+			node.Value = value
+		}
+		if err != nil {
+			if err == SkipAll {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Transform returns a copy of the document rewritten by fn. The original
+// document is not modified.
+func Transform(doc *Document, fn WalkFunc) (*Document, error) {
+	result := doc.Clone()
+	if err := Walk(result, fn); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// walkValue visits value and its children. It returns the replacement
+// value and whether the callback replaced it; children that are replaced
+// are stored into value in place.
+func walkValue(doc *Document, path Path, typ string, value Value, fn WalkFunc) (Value, bool, error) {
+	c := &Cursor{Path: path, Type: typ, Value: value}
+	err := fn(c)
+	if c.replaced {
+		doc.pruneReplaced(path, value, c.Value)
+		value = c.Value
+	}
+	if err == SkipChildren {
+		return value, c.replaced, nil
+	}
+	if err != nil {
+		return value, c.replaced, err
+	}
+
+	switch v := value.(type) {
+	case Block:
+		err = walkMap(doc, path, v, fn)
+	case map[string]any:
+		err = walkMap(doc, path, v, fn)
+	case List:
+		err = walkList(doc, path, v, fn)
+	case []any:
+		err = walkList(doc, path, v, fn)
+	}
+	return value, c.replaced, err
+}
+
+func walkMap[M ~map[string]V, V any](doc *Document, path Path, m M, fn WalkFunc) error {
+	for _, c := range mapChildren(m) {
+		p := path.Key(c.elem.Key)
+		updated, replaced, err := walkValue(doc, p, doc.annotation(p), c.value, fn)
+		if replaced {
+			m[c.elem.Key], _ = updated.(V)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkList[L ~[]V, V any](doc *Document, path Path, l L, fn WalkFunc) error {
+	for i := range l {
+		p := path.Index(i)
+		updated, replaced, err := walkValue(doc, p, doc.annotation(p), l[i], fn)
+		if replaced {
+			l[i], _ = updated.(V)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
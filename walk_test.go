@@ -0,0 +1,140 @@
+package up
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const walkTestDoc = `name api
+port!int 8080
+database {
+password secret
+replicas [
+{
+host db1
+password hunter2
+}
+]
+}
+internal {
+token abc
+}
+`
+
+func TestWalk(t *testing.T) {
+	doc, err := NewParser().ParseDocument(strings.NewReader(walkTestDoc))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	var visited []string
+	err = Walk(doc, func(c *Cursor) error {
+		entry := c.Path.String()
+		if c.Type != "" {
+			entry += "!" + c.Type
+		}
+		visited = append(visited, entry)
+		if c.Path.String() == "internal" {
+			return SkipChildren
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() failed: %v", err)
+	}
+
+	expected := "name port!int database database.password database.replicas " +
+		"database.replicas[0] database.replicas[0].host database.replicas[0].password internal"
+	if strings.Join(visited, " ") != expected {
+		t.Errorf("Walk() visited:\nexpected: %s\ngot:      %s", expected, strings.Join(visited, " "))
+	}
+
+	count := 0
+	err = Walk(doc, func(c *Cursor) error {
+		count++
+		if count == 2 {
+			return SkipAll
+		}
+		return nil
+	})
+	if err != nil || count != 2 {
+		t.Errorf("SkipAll: err=%v count=%d", err, count)
+	}
+
+	boom := errors.New("boom")
+	if err := Walk(doc, func(c *Cursor) error { return boom }); err != boom {
+		t.Errorf("expected walk error to be returned, got %v", err)
+	}
+}
+
+func TestTransform(t *testing.T) {
+	doc, err := NewParser().ParseDocument(strings.NewReader(walkTestDoc))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	redacted, err := Transform(doc, func(c *Cursor) error {
+		last := c.Path[len(c.Path)-1]
+		if !last.IsIndex && (last.Key == "password" || last.Key == "token") {
+			c.Replace("***")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transform() failed: %v", err)
+	}
+
+	for _, path := range []string{"database.password", "database.replicas[0].password", "internal.token"} {
+		if v, _ := redacted.Get(path); v != "***" {
+			t.Errorf("%s: expected redacted value, got %v", path, v)
+		}
+	}
+	if v, _ := doc.Get("database.password"); v != "secret" {
+		t.Errorf("original document was modified: %v", v)
+	}
+}
+
+func TestTransformDropsReplacedAnnotations(t *testing.T) {
+	doc, err := NewParser().ParseDocument(strings.NewReader("limits {\n  cpu!int 2\n}\n"))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	result, err := Transform(doc, func(c *Cursor) error {
+		if c.Path.String() == "limits" {
+			c.Replace(Block{"cpu": List{"a", "b"}})
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transform() failed: %v", err)
+	}
+	if typ := result.Annotation("limits.cpu"); typ != "" {
+		t.Errorf("expected no annotation on the replaced limits.cpu, got %q", typ)
+	}
+	if typ := doc.Annotation("limits.cpu"); typ != "int" {
+		t.Errorf("original annotation was modified: %q", typ)
+	}
+}
+
+func TestWalkReadOnly(t *testing.T) {
+	doc, err := NewParser().ParseDocument(strings.NewReader(walkTestDoc))
+	if err != nil {
+		t.Fatalf("ParseDocument() failed: %v", err)
+	}
+
+	// Concurrent read-only walks must not write to the document; run with
+	// -race to check.
+	done := make(chan error)
+	for i := 0; i < 4; i++ {
+		go func() {
+			done <- Walk(doc, func(c *Cursor) error { return nil })
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("Walk() failed: %v", err)
+		}
+	}
+}